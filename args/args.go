@@ -3,8 +3,12 @@ package args
 import (
 	"os"
 	"path/filepath"
+	"slices"
 	"strings"
+	"sync"
 	"unicode"
+
+	"github.com/coxley/complete/cmplog"
 )
 
 // Parser accepts all completed arguments from the command-line and returns
@@ -32,15 +36,40 @@ type Args struct {
 	// If the last character in the command line is space, this would be the
 	// last word, otherwise, it would be the word before that.
 	LastCompleted string
-
-	// ParsedRoot is the return value of [Parser.Parse], and should be the root command
-	// structure for your CLI framework.
-	//
-	// It's useful for a more complex, dynamic [Predictor]. For example, returning
-	// different options depending on another flag value or positional argument.
+	// ParsedRoot is the return value of [Parser.Parse].
 	//
-	// Always 'nil' when no Parser is provided.
+	// Deprecated: use [Args.Root], which parses on first use. This is only filled
+	// for parsers that aren't wrapped with [Lazy], and will be removed in the next
+	// major version.
 	ParsedRoot any
+
+	// root is parsed on first use, and shared by copies made with From
+	root *lazyRoot
+	// values attached with WithValue, most recent first
+	values *valueNode
+	// directive is shared by copies, so any predictor can set it
+	directive *Directive
+	// logf replaces cmplog.Log for this completion, when set
+	logf func(format string, args ...any)
+	// dir replaces the working directory for relative paths, when set
+	dir string
+	// line is the command-line up to the cursor, and offsets where each of All
+	// starts within it
+	line    string
+	offsets []int
+
+	// The fields below are filled in from the command tree before predictors run.
+
+	// Path of sub-commands the user has typed, not including the program itself
+	Path []string
+	// Flag whose value is being completed, or empty when completing anything else
+	Flag string
+	// Position is the index of the positional argument being completed, counting from
+	// zero after the last sub-command
+	Position int
+	// FlagValues holds the values already given for each flag, keyed by the flag as
+	// it's named in the tree. Flags that don't take a value are given "true".
+	FlagValues map[string][]string
 }
 
 // Directory gives the directory of the current written
@@ -60,27 +89,177 @@ func (a Args) Directory() string {
 }
 
 func New(line string, parser Parser) Args {
+	return newArgs(line, splitFields(line), fieldOffsets(line), parser)
+}
+
+// NewWords is like [New], for shells that split the command-line themselves. The
+// last word is the one at the cursor, or empty when a new one was started.
+//
+// Words are kept whole, even when quoted by the user to contain spaces.
+func NewWords(words []string, parser Parser) Args {
+	line := strings.Join(words, " ")
+	offsets := make([]int, 0, len(words))
+	start := 0
+	for _, w := range words {
+		offsets = append(offsets, start)
+		start += len(w) + 1
+	}
+	if len(words) > 0 {
+		offsets = splitLastOffsets(line, offsets)
+	}
+	return newArgs(line, splitLastEqual(slices.Clone(words)), offsets, parser)
+}
+
+func newArgs(line string, parts []string, offsets []int, parser Parser) Args {
 	var (
 		all       []string
 		completed []string
 	)
-	parts := splitFields(line)
 	if len(parts) > 0 {
 		all = parts[1:]
 		completed = removeLast(parts[1:])
+		offsets = offsets[1:]
+	} else {
+		offsets = nil
 	}
 
-	var root any
+	var root *lazyRoot
 	if parser != nil {
-		root = parser.Parse(completed)
+		root = &lazyRoot{parse: func() any { return parser.Parse(completed) }}
 	}
-	return Args{
+	a := Args{
 		All:           all,
 		Completed:     completed,
 		Last:          last(parts),
 		LastCompleted: last(completed),
-		ParsedRoot:    root,
+		root:          root,
+		directive:     new(Directive),
+		line:          line,
+		offsets:       offsets,
+	}
+	if _, ok := parser.(lazyParser); parser != nil && !ok {
+		a.ParsedRoot = a.Root()
+	}
+	return a
+}
+
+// Lazy wraps 'p' so that it's only parsed when a predictor calls [Args.Root], rather
+// than up front to fill the deprecated [Args.ParsedRoot] field
+func Lazy(p Parser) Parser {
+	if p == nil {
+		return nil
+	}
+	if _, ok := p.(lazyParser); ok {
+		return p
+	}
+	return lazyParser{p}
+}
+
+type lazyParser struct {
+	Parser
+}
+
+// Line returns the command-line as typed from the first of All, and the cursor
+// position within it
+//
+// Unlike joining All, spacing and the '=' of '--flag=value' are kept. This is what
+// to hand another program to complete, after the arguments before it are dropped
+// with [Args.From]. Empty for Args that weren't made by [New].
+func (a Args) Line() (line string, point int) {
+	if len(a.offsets) == 0 {
+		return "", 0
+	}
+	line = a.line[a.offsets[0]:]
+	return line, len(line)
+}
+
+// Root is the return value of [Parser.Parse], and should be the root command
+// structure for your CLI framework.
+//
+// It's useful for a more complex, dynamic [Predictor]. For example, returning
+// different options depending on another flag value or positional argument.
+//
+// Parsing is deferred until the first call, and the result is reused for the rest of
+// the completion. Always 'nil' when no Parser is provided.
+func (a Args) Root() any {
+	if a.root == nil {
+		return nil
+	}
+	a.root.once.Do(func() {
+		a.root.value = a.root.parse()
+		a.root.parse = nil
+	})
+	return a.root.value
+}
+
+// WithValue returns a copy of Args that carries 'val' for 'key', shadowing any
+// previous value for the same key
+//
+// This lets programs hand dependencies, like API clients or loaded config, to
+// predictors without globals. Like [context.WithValue], keys should be of an
+// unexported type to avoid collisions.
+func (a Args) WithValue(key, val any) Args {
+	a.values = &valueNode{key: key, val: val, next: a.values}
+	return a
+}
+
+// Value returns the value attached for 'key', or nil if there isn't one
+func (a Args) Value(key any) any {
+	for n := a.values; n != nil; n = n.next {
+		if n.key == key {
+			return n.val
+		}
 	}
+	return nil
+}
+
+// WithLogger returns a copy of Args that logs to 'fn' in place of [cmplog.Log]
+func (a Args) WithLogger(fn func(format string, args ...any)) Args {
+	a.logf = fn
+	return a
+}
+
+// Log writes a debug log for the current completion
+//
+// Predictors should prefer this over [cmplog.Log], so that logs go wherever the
+// program asked for them.
+func (a Args) Log(format string, args ...any) {
+	if a.logf != nil {
+		a.logf(format, args...)
+		return
+	}
+	cmplog.Log(format, args...)
+}
+
+// WithDir returns a copy of Args that resolves relative paths from 'dir', rather
+// than the working directory of the process
+func (a Args) WithDir(dir string) Args {
+	a.dir = dir
+	return a
+}
+
+// Dir is the directory the user is completing from. Predictors that look at the
+// filesystem should resolve relative paths from here, since completion may be
+// running in another process, like a completion server.
+//
+// It's always absolute, unless the working directory can't be found.
+func (a Args) Dir() string {
+	dir, err := filepath.Abs(a.dir)
+	if err != nil {
+		return "."
+	}
+	return dir
+}
+
+type valueNode struct {
+	key, val any
+	next     *valueNode
+}
+
+type lazyRoot struct {
+	once  sync.Once
+	parse func() any
+	value any
 }
 
 // splitFields returns a list of fields from the given command line.
@@ -101,6 +280,38 @@ func splitFields(line string) []string {
 	return parts
 }
 
+// fieldOffsets returns where each field of [splitFields] starts within 'line'
+func fieldOffsets(line string) []int {
+	var offsets []int
+	inField := false
+	for i, r := range line {
+		space := unicode.IsSpace(r)
+		if !space && !inField {
+			offsets = append(offsets, i)
+		}
+		inField = !space
+	}
+	if len(line) > 0 && unicode.IsSpace(rune(line[len(line)-1])) {
+		offsets = append(offsets, len(line))
+	}
+	if len(offsets) == 0 {
+		return offsets
+	}
+	return splitLastOffsets(line, offsets)
+}
+
+// splitLastOffsets adds where each part of the last field starts, when it's of the
+// form "a=b", matching [splitLastEqual]
+func splitLastOffsets(line string, offsets []int) []int {
+	start := offsets[len(offsets)-1]
+	offsets = offsets[:len(offsets)-1]
+	for _, part := range strings.Split(line[start:], "=") {
+		offsets = append(offsets, start)
+		start += len(part) + 1
+	}
+	return offsets
+}
+
 func splitLastEqual(line []string) []string {
 	if len(line) == 0 {
 		return line
@@ -115,6 +326,9 @@ func (a Args) From(i int) Args {
 		i = len(a.All) - 1
 	}
 	a.All = a.All[i+1:]
+	if i < len(a.offsets) {
+		a.offsets = a.offsets[i+1:]
+	}
 
 	if i >= len(a.Completed) {
 		i = len(a.Completed) - 1
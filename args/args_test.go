@@ -144,6 +144,56 @@ func TestArgs_From(t *testing.T) {
 	}
 }
 
+func TestArgs_Line(t *testing.T) {
+	t.Parallel()
+	tests := []struct {
+		line string
+		from int
+		want string
+	}{
+		{line: "cmd exec -- kubectl get po", from: 1, want: "kubectl get po"},
+		{line: "cmd exec -- kubectl  get ", from: 1, want: "kubectl  get "},
+		{line: "cmd exec -- kubectl --ns=kube", from: 1, want: "kubectl --ns=kube"},
+		{line: "cmd --ns=kube", from: 0, want: "kube"},
+		{line: "cmd ", from: -1, want: ""},
+		{line: "cmd a b", from: 5, want: ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(fmt.Sprintf("%s/%d", tt.line, tt.from), func(t *testing.T) {
+			a := New(tt.line, nil)
+			if tt.from >= 0 {
+				a = a.From(tt.from)
+			}
+			line, point := a.Line()
+			assert.Equal(t, tt.want, line)
+			assert.Equal(t, len(tt.want), point)
+		})
+	}
+
+	line, _ := Args{All: []string{"a"}}.Line()
+	assert.Empty(t, line)
+}
+
+func TestNewWords(t *testing.T) {
+	t.Parallel()
+
+	a := NewWords([]string{"cmd", "open", "my file.txt", "--mode=r"}, nil)
+	assert.Equal(t, []string{"open", "my file.txt", "--mode", "r"}, a.All)
+	assert.Equal(t, []string{"open", "my file.txt", "--mode"}, a.Completed)
+	assert.Equal(t, "r", a.Last)
+	assert.Equal(t, "--mode", a.LastCompleted)
+
+	line, point := a.From(0).Line()
+	assert.Equal(t, "my file.txt --mode=r", line)
+	assert.Equal(t, len(line), point)
+
+	a = NewWords([]string{"cmd", ""}, nil)
+	assert.Equal(t, []string{""}, a.All)
+	assert.Empty(t, a.Completed)
+	assert.Empty(t, NewWords(nil, nil).All)
+}
+
 func TestArgs_Directory(t *testing.T) {
 	t.Parallel()
 
@@ -211,3 +261,59 @@ func TestArgs_Directory(t *testing.T) {
 		})
 	}
 }
+
+type countingParser struct {
+	calls int
+}
+
+func (p *countingParser) Parse(args []string) any {
+	p.calls++
+	return strings.Join(args, " ")
+}
+
+func TestArgs_Root(t *testing.T) {
+	t.Parallel()
+
+	parser := &countingParser{}
+	a := New("cmd a b c", Lazy(parser))
+	assert.Equal(t, 0, parser.calls, "parsed before being asked for")
+	assert.Nil(t, a.ParsedRoot)
+
+	// Copies share the result, and parse at most once
+	assert.Equal(t, "a b", a.From(0).Root())
+	assert.Equal(t, "a b", a.Root())
+	assert.Equal(t, 1, parser.calls)
+
+	assert.Nil(t, New("cmd a", nil).Root())
+	assert.Nil(t, Lazy(nil))
+}
+
+func TestArgs_ParsedRoot(t *testing.T) {
+	t.Parallel()
+
+	// Without Lazy, the deprecated field is filled up front, and Root reuses it
+	parser := &countingParser{}
+	a := New("cmd a b c", parser)
+	assert.Equal(t, "a b", a.ParsedRoot)
+	assert.Equal(t, "a b", a.Root())
+	assert.Equal(t, 1, parser.calls)
+
+	assert.Nil(t, New("cmd a", nil).ParsedRoot)
+}
+
+func TestArgs_WithDirective(t *testing.T) {
+	t.Parallel()
+
+	a := New("cmd ", nil)
+	a.SetDirective(DirectiveNoSpace)
+
+	b := a.WithDirective(a.Directive())
+	b.SetDirective(DirectiveDefault)
+	assert.Equal(t, DirectiveNoSpace|DirectiveDefault, b.Directive())
+	assert.Equal(t, DirectiveNoSpace, a.Directive())
+
+	// Copies made after share the new directives
+	c := b.From(0)
+	c.SetDirective(DirectiveFilenames)
+	assert.Equal(t, DirectiveNoSpace|DirectiveDefault|DirectiveFilenames, b.Directive())
+}
@@ -0,0 +1,40 @@
+package args
+
+// Directive tells the shell how to treat suggestions. Predictors set them with
+// [Args.SetDirective], and they're combined for the whole completion.
+//
+// Only shells whose installed scripts understand directives act on them.
+type Directive int
+
+const (
+	// DirectiveNoSpace stops the shell adding a space after the suggestion
+	DirectiveNoSpace Directive = 1 << iota
+	// DirectiveFilenames treats suggestions as paths, which the shell may quote and
+	// show by their base name
+	DirectiveFilenames
+	// DirectiveDefault falls back to the shell's own completion, usually file
+	// names, when there are no suggestions
+	DirectiveDefault
+)
+
+// SetDirective adds 'd' to the directives given to the shell
+func (a Args) SetDirective(d Directive) {
+	if a.directive != nil {
+		*a.directive |= d
+	}
+}
+
+// Directive returns the directives set so far
+func (a Args) Directive() Directive {
+	if a.directive == nil {
+		return 0
+	}
+	return *a.directive
+}
+
+// WithDirective returns a copy of Args whose directives start as 'd', and are no
+// longer shared with 'a' or its other copies
+func (a Args) WithDirective(d Directive) Args {
+	a.directive = &d
+	return a
+}
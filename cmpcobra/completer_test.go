@@ -20,7 +20,7 @@ func TestQuery(t *testing.T) {
 	cmd.Flags().StringSliceP("column", "c", nil, "column to select")
 
 	RegisterFlag(cmd, "column", predict.Func(func(args args.Args) []string {
-		cmd := args.ParsedRoot.(*cobra.Command)
+		cmd := args.Root().(*cobra.Command)
 		posArgs := cmd.Flags().Args()
 
 		if len(posArgs) == 0 {
@@ -96,7 +96,7 @@ func TestPersistent(t *testing.T) {
 
 	for _, tt := range tests {
 		pred := predict.Func(func(args args.Args) []string {
-			root := args.ParsedRoot.(*cobra.Command)
+			root := args.Root().(*cobra.Command)
 			child := root.Commands()[0]
 			got, err := child.Flags().GetString("env")
 			require.NoError(t, err)
@@ -0,0 +1,448 @@
+// Package cmprepl runs an interactive shell for a program, completing input with the
+// same tree used for shell completion
+//
+// The terminal should be put into raw mode by the caller, such as with
+// golang.org/x/term, so that key presses are read as they happen:
+//
+//	state, err := term.MakeRaw(int(os.Stdin.Fd()))
+//	if err != nil {
+//		return err
+//	}
+//	defer term.Restore(int(os.Stdin.Fd()), state)
+//
+//	r := cmprepl.New(cmpcobra.New(cmd), func(args []string) error {
+//		cmd.SetArgs(args)
+//		return cmd.Execute()
+//	})
+//	return r.Run(os.Stdin, os.Stdout)
+//
+// Output written while in raw mode needs "\r\n" to start a new line.
+package cmprepl
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"slices"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/coxley/complete"
+	"github.com/coxley/complete/args"
+)
+
+// ErrExit can be returned by the run function to stop the REPL
+var ErrExit = errors.New("exit")
+
+// Keys we act on. Anything else that isn't printable is ignored.
+const (
+	keyCtrlA     = 0x01
+	keyCtrlC     = 0x03
+	keyCtrlD     = 0x04
+	keyCtrlE     = 0x05
+	keyBackspace = 0x08
+	keyTab       = '\t'
+	keyLF        = '\n'
+	keyCR        = '\r'
+	keyEscape    = 0x1b
+	keyDelete    = 0x7f
+)
+
+// REPL reads lines from a terminal, completing them on TAB, and runs each one
+type REPL struct {
+	cp      complete.CommandParser
+	run     func(args []string) error
+	options options
+
+	history []string
+}
+
+type options struct {
+	prompt      string
+	name        string
+	maxHistory  int
+	completeOps []complete.Option
+}
+
+// Option customizes a [REPL]
+type Option func(*options)
+
+// Prompt printed before each line. Defaults to "> ".
+func Prompt(prompt string) Option {
+	return func(o *options) {
+		o.prompt = prompt
+	}
+}
+
+// Name of the program, given to predictors as the first word. Defaults to "repl".
+func Name(name string) Option {
+	return func(o *options) {
+		o.name = name
+	}
+}
+
+// MaxHistory limits how many lines are remembered. Defaults to 1000.
+func MaxHistory(n int) Option {
+	return func(o *options) {
+		o.maxHistory = n
+	}
+}
+
+// CompleteOptions are given to [complete.Suggest] when completing
+func CompleteOptions(opts ...complete.Option) Option {
+	return func(o *options) {
+		o.completeOps = append(o.completeOps, opts...)
+	}
+}
+
+// New returns a REPL completed by 'cp', calling 'run' with the words of each line
+//
+// Lines are split into words like a shell would, so quotes and backslashes keep
+// spaces within a word.
+//
+// Errors returned by 'run' are printed, except for [ErrExit] which stops the REPL.
+func New(cp complete.CommandParser, run func(args []string) error, opts ...Option) *REPL {
+	o := options{
+		prompt:     "> ",
+		name:       "repl",
+		maxHistory: 1000,
+	}
+	for _, fn := range opts {
+		fn(&o)
+	}
+	return &REPL{cp: cp, run: run, options: o}
+}
+
+// History returns the lines that have been run, oldest first
+func (r *REPL) History() []string {
+	return slices.Clone(r.history)
+}
+
+// Run reads key presses from 'in' until it's closed, Ctrl-D is pressed on an empty
+// line, or the run function returns [ErrExit]
+func (r *REPL) Run(in io.Reader, out io.Writer) error {
+	e := &editor{
+		repl: r,
+		in:   bufio.NewReader(in),
+		out:  out,
+		// One past the newest entry is the line being edited
+		histPos: len(r.history),
+	}
+	return e.loop()
+}
+
+// editor holds the state of the line being edited
+type editor struct {
+	repl *REPL
+	in   *bufio.Reader
+	out  io.Writer
+
+	line   []rune
+	cursor int
+
+	// histPos is the entry being shown, and draft is what was typed before moving
+	// through history
+	histPos int
+	draft   []rune
+}
+
+func (e *editor) loop() error {
+	e.redraw()
+	for {
+		key, _, err := e.in.ReadRune()
+		if errors.Is(err, io.EOF) {
+			fmt.Fprint(e.out, "\r\n")
+			return nil
+		} else if err != nil {
+			return err
+		}
+
+		switch key {
+		case keyCR, keyLF:
+			// Terminals send "\r\n" for enter when not in raw mode
+			if key == keyCR {
+				if next, err := e.in.Peek(1); err == nil && next[0] == keyLF {
+					e.in.ReadByte()
+				}
+			}
+			if err := e.submit(); err != nil {
+				if errors.Is(err, ErrExit) {
+					return nil
+				}
+				return err
+			}
+		case keyTab:
+			e.complete()
+		case keyBackspace, keyDelete:
+			if e.cursor > 0 {
+				e.line = append(e.line[:e.cursor-1], e.line[e.cursor:]...)
+				e.cursor--
+			}
+		case keyCtrlA:
+			e.cursor = 0
+		case keyCtrlE:
+			e.cursor = len(e.line)
+		case keyCtrlC:
+			fmt.Fprint(e.out, "^C\r\n")
+			e.reset()
+		case keyCtrlD:
+			if len(e.line) == 0 {
+				fmt.Fprint(e.out, "\r\n")
+				return nil
+			}
+		case keyEscape:
+			e.escape()
+		default:
+			if unicode.IsPrint(key) {
+				e.insert(string(key))
+			}
+		}
+		e.redraw()
+	}
+}
+
+// escape handles the keys sent as escape sequences
+//
+// Arrows, Home, and End come as "ESC [ <letter>", or "ESC O <letter>" when the
+// terminal is in application mode. Others, like Delete, are "ESC [ <number> ~". A
+// lone ESC is ignored, rather than waiting for a key that may never come.
+func (e *editor) escape() {
+	// Terminals write a sequence all at once, so it's already buffered if this is one.
+	// Otherwise, what follows is a key of its own.
+	if e.in.Buffered() < 2 {
+		return
+	}
+	kind, _ := e.in.ReadByte()
+	if kind != '[' && kind != 'O' {
+		e.in.UnreadByte()
+		return
+	}
+
+	b, _ := e.in.ReadByte()
+	var params []byte
+	if kind == '[' {
+		// Parameter and intermediate bytes come before the final one
+		for b >= 0x20 && b <= 0x3f && e.in.Buffered() > 0 {
+			params = append(params, b)
+			b, _ = e.in.ReadByte()
+		}
+		if b < 0x40 || b > 0x7e {
+			return
+		}
+	}
+
+	// Modifiers, like Ctrl in "ESC [ 1 ; 5 C", follow the first parameter
+	first, _, _ := strings.Cut(string(params), ";")
+	switch {
+	case b == 'A':
+		e.moveHistory(-1)
+	case b == 'B':
+		e.moveHistory(1)
+	case b == 'C':
+		e.cursor = min(e.cursor+1, len(e.line))
+	case b == 'D':
+		e.cursor = max(e.cursor-1, 0)
+	case b == 'H', b == '~' && (first == "1" || first == "7"):
+		e.cursor = 0
+	case b == 'F', b == '~' && (first == "4" || first == "8"):
+		e.cursor = len(e.line)
+	case b == '~' && first == "3":
+		if e.cursor < len(e.line) {
+			e.line = append(e.line[:e.cursor], e.line[e.cursor+1:]...)
+		}
+	}
+}
+
+// moveHistory shows an older (-1) or newer (1) entry in place of the current line
+func (e *editor) moveHistory(delta int) {
+	history := e.repl.history
+	pos := e.histPos + delta
+	if pos < 0 || pos > len(history) {
+		return
+	}
+
+	if e.histPos == len(history) {
+		e.draft = e.line
+	}
+	e.histPos = pos
+	if pos == len(history) {
+		e.line = e.draft
+	} else {
+		e.line = []rune(history[pos])
+	}
+	e.cursor = len(e.line)
+}
+
+// insert 's' at the cursor
+func (e *editor) insert(s string) {
+	ins := []rune(s)
+	e.line = append(e.line[:e.cursor], append(ins, e.line[e.cursor:]...)...)
+	e.cursor += len(ins)
+}
+
+// reset to an empty line
+func (e *editor) reset() {
+	e.line = nil
+	e.cursor = 0
+	e.draft = nil
+	e.histPos = len(e.repl.history)
+}
+
+// submit runs the current line
+func (e *editor) submit() error {
+	fmt.Fprint(e.out, "\r\n")
+	line := string(e.line)
+	e.remember(line)
+	e.reset()
+
+	words, err := splitWords(line)
+	if err != nil {
+		fmt.Fprintf(e.out, "error: %v\r\n", err)
+		return nil
+	}
+	if len(words) == 0 {
+		return nil
+	}
+	err = e.repl.run(words)
+	if err != nil && !errors.Is(err, ErrExit) {
+		fmt.Fprintf(e.out, "error: %v\r\n", err)
+		return nil
+	}
+	return err
+}
+
+// remember adds 'line' to the history, skipping blanks and repeats
+func (e *editor) remember(line string) {
+	r := e.repl
+	if strings.TrimSpace(line) == "" {
+		return
+	}
+	if len(r.history) > 0 && r.history[len(r.history)-1] == line {
+		return
+	}
+	r.history = append(r.history, line)
+	if over := len(r.history) - r.options.maxHistory; over > 0 {
+		r.history = r.history[over:]
+	}
+}
+
+// complete the word at the cursor
+//
+// A single suggestion replaces the word. With several, their common prefix is
+// inserted, or they're listed if that doesn't add anything.
+func (e *editor) complete() {
+	o := e.repl.options
+	prefix := o.name + " "
+	before := string(e.line[:e.cursor])
+	res := complete.Suggest(e.repl.cp, prefix+before, len(prefix)+len(before), o.completeOps...)
+	if len(res.Suggestions) == 0 {
+		return
+	}
+
+	// Offsets are in bytes of the line we gave, but the cursor counts runes
+	start := len([]rune(before[:res.Start-len(prefix)]))
+	word := string(e.line[start:e.cursor])
+	common := commonPrefix(res.Suggestions)
+	if len(res.Suggestions) > 1 && len(common) <= len(word) {
+		slices.Sort(res.Suggestions)
+		fmt.Fprintf(e.out, "\r\n%s\r\n", strings.Join(res.Suggestions, "  "))
+		return
+	}
+
+	// Escaped so the line splits back into the same word when it's run
+	replacement := escapeWord(common)
+	if len(res.Suggestions) == 1 && res.Directive&args.DirectiveNoSpace == 0 {
+		replacement += " "
+	}
+
+	e.line = append(e.line[:start:start], append([]rune(replacement), e.line[e.cursor:]...)...)
+	e.cursor = start + len([]rune(replacement))
+}
+
+// redraw the prompt and line, placing the cursor where it belongs
+func (e *editor) redraw() {
+	fmt.Fprintf(e.out, "\r\x1b[K%s%s", e.repl.options.prompt, string(e.line))
+	if back := len(e.line) - e.cursor; back > 0 {
+		fmt.Fprintf(e.out, "\x1b[%dD", back)
+	}
+}
+
+// commonPrefix returns the longest prefix shared by every string
+func commonPrefix(ss []string) string {
+	prefix := ss[0]
+	for _, s := range ss[1:] {
+		for !strings.HasPrefix(s, prefix) {
+			_, size := utf8.DecodeLastRuneInString(prefix)
+			prefix = prefix[:len(prefix)-size]
+		}
+	}
+	return prefix
+}
+
+// escapeWord puts a backslash before anything [splitWords] would treat specially,
+// so 's' is read back as a single word
+func escapeWord(s string) string {
+	var b strings.Builder
+	for _, r := range s {
+		if unicode.IsSpace(r) || strings.ContainsRune(`'"\`, r) {
+			b.WriteRune('\\')
+		}
+		b.WriteRune(r)
+	}
+	return b.String()
+}
+
+// splitWords splits 'line' on whitespace, like a POSIX shell
+//
+// Single quotes keep everything within them. Double quotes do the same, except a
+// backslash escapes '"', '\\', '$', and '`'. Outside of quotes, a backslash escapes
+// any character.
+func splitWords(line string) ([]string, error) {
+	var (
+		words []string
+		word  strings.Builder
+		// inWord is true once a word has started, even if it's empty like ''
+		inWord bool
+		quote  rune
+		escape bool
+	)
+	for _, r := range line {
+		switch {
+		case escape:
+			if quote == '"' && !strings.ContainsRune("\"\\$`", r) {
+				word.WriteRune('\\')
+			}
+			word.WriteRune(r)
+			escape = false
+		case r == '\\' && quote != '\'':
+			escape, inWord = true, true
+		case quote != 0 && r == quote:
+			quote = 0
+		case quote != 0:
+			word.WriteRune(r)
+		case r == '\'' || r == '"':
+			quote, inWord = r, true
+		case unicode.IsSpace(r):
+			if inWord {
+				words = append(words, word.String())
+				word.Reset()
+				inWord = false
+			}
+		default:
+			word.WriteRune(r)
+			inWord = true
+		}
+	}
+	if quote != 0 {
+		return nil, fmt.Errorf("unterminated %c quote", quote)
+	}
+	if escape {
+		return nil, errors.New("trailing backslash")
+	}
+	if inWord {
+		words = append(words, word.String())
+	}
+	return words, nil
+}
@@ -0,0 +1,184 @@
+package cmprepl_test
+
+import (
+	"bytes"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/coxley/complete"
+	"github.com/coxley/complete/cmprepl"
+	"github.com/coxley/complete/predict"
+)
+
+const (
+	up     = "\x1b[A"
+	down   = "\x1b[B"
+	left   = "\x1b[D"
+	home   = "\x1b[1~"
+	end    = "\x1b[4~"
+	delete = "\x1b[3~"
+)
+
+func newREPL(ran *[][]string, opts ...cmprepl.Option) *cmprepl.REPL {
+	cp := complete.NopParser(complete.Command{
+		Sub: complete.Commands{
+			"status": {},
+			"start": {
+				Flags: complete.Flags{
+					"--env": predict.Set("prod", "staging"),
+				},
+			},
+			"open": {
+				Args: predict.Set("my file.txt", `it's "new"`, `back\slash`),
+			},
+			"exit": {},
+		},
+	})
+	return cmprepl.New(cp, func(args []string) error {
+		*ran = append(*ran, args)
+		switch args[0] {
+		case "exit":
+			return cmprepl.ErrExit
+		case "fail":
+			return errors.New("boom")
+		}
+		return nil
+	}, opts...)
+}
+
+func TestREPL(t *testing.T) {
+	tests := []struct {
+		name  string
+		input string
+		want  [][]string
+	}{
+		{
+			name:  "run",
+			input: "status\rstart --env prod\r",
+			want:  [][]string{{"status"}, {"start", "--env", "prod"}},
+		},
+		{
+			name:  "complete single",
+			input: "sto\x7far\t--e\tp\t\r",
+			want:  [][]string{{"start", "--env", "prod"}},
+		},
+		{
+			name: "complete common prefix",
+			// 'sta' is shared by 'status' and 'start', so another letter is needed
+			input: "s\tr\t\r",
+			want:  [][]string{{"start"}},
+		},
+		{
+			name:  "complete escapes spaces and quotes",
+			input: "open my\t\ropen it\t\ropen ba\t\r",
+			want:  [][]string{{"open", "my file.txt"}, {"open", `it's "new"`}, {"open", `back\slash`}},
+		},
+		{
+			name:  "home, end, and delete",
+			input: "tatusx" + home + "s" + end + left + delete + "\r",
+			want:  [][]string{{"status"}},
+		},
+		{
+			name:  "application mode arrows",
+			input: "statu" + "\x1bOD\x1bOC" + "s\r",
+			want:  [][]string{{"status"}},
+		},
+		{
+			name:  "modified arrows",
+			input: "tatus" + "\x1b[1;5D" + strings.Repeat(left, 4) + "s\r",
+			want:  [][]string{{"status"}},
+		},
+		{
+			name:  "lone escape",
+			input: "\x1bstatus\r\x1b",
+			want:  [][]string{{"status"}},
+		},
+		{
+			name:  "quoted words",
+			input: `start --env 'prod eu' "a \"b\"" c\ d ''` + "\r",
+			want:  [][]string{{"start", "--env", "prod eu", `a "b"`, "c d", ""}},
+		},
+		{
+			name:  "unterminated quote",
+			input: "start 'prod\rstatus\r",
+			want:  [][]string{{"status"}},
+		},
+		{
+			name:  "history",
+			input: "status\rstart\r" + up + up + "\r" + up + up + down + "\r",
+			want:  [][]string{{"status"}, {"start"}, {"status"}, {"status"}},
+		},
+		{
+			name:  "history keeps draft",
+			input: "status\rst" + up + down + "art\r",
+			want:  [][]string{{"status"}, {"start"}},
+		},
+		{
+			name:  "ctrl-c clears line",
+			input: "status\x03start\r",
+			want:  [][]string{{"start"}},
+		},
+		{
+			name:  "exit",
+			input: "status\rexit\rstart\r",
+			want:  [][]string{{"status"}, {"exit"}},
+		},
+		{
+			name:  "ctrl-d",
+			input: "status\r\x04start\r",
+			want:  [][]string{{"status"}},
+		},
+		{
+			name:  "errors are printed",
+			input: "fail\rstatus\r",
+			want:  [][]string{{"fail"}, {"status"}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var ran [][]string
+			repl := newREPL(&ran)
+			err := repl.Run(strings.NewReader(tt.input), new(bytes.Buffer))
+			require.NoError(t, err)
+			require.Equal(t, tt.want, ran)
+		})
+	}
+}
+
+func TestREPL_Output(t *testing.T) {
+	var ran [][]string
+	repl := newREPL(&ran, cmprepl.Prompt("$ "))
+	out := new(bytes.Buffer)
+
+	// Nothing in common past 'sta', so the options are listed
+	err := repl.Run(strings.NewReader("sta\t\x03fail\r'x\r"), out)
+	require.NoError(t, err)
+	require.Contains(t, out.String(), "\r\nstart  status\r\n")
+	require.Contains(t, out.String(), "error: boom\r\n")
+	require.True(t, strings.HasPrefix(out.String(), "\r\x1b[K$ "))
+	require.Contains(t, out.String(), "error: unterminated ' quote\r\n")
+	require.Equal(t, []string{"fail", "'x"}, repl.History())
+
+	// Changing what's returned doesn't change what's remembered
+	repl.History()[0] = "changed"
+	require.Equal(t, []string{"fail", "'x"}, repl.History())
+}
+
+func TestREPL_CompleteMidLine(t *testing.T) {
+	var ran [][]string
+	repl := newREPL(&ran, cmprepl.Prompt("$ "))
+	out := new(bytes.Buffer)
+
+	// The word before the cursor is completed, keeping what's after it
+	input := "--env prod" + strings.Repeat(left, 10) + "star\t\r"
+	err := repl.Run(strings.NewReader(input), out)
+	require.NoError(t, err)
+
+	// Redrawn with the cursor just after the completed word and its space
+	require.Contains(t, out.String(), "\r\x1b[K$ start --env prod\x1b[10D")
+	require.Equal(t, [][]string{{"start", "--env", "prod"}}, ran)
+}
@@ -52,6 +52,21 @@ func TestCobra(t *testing.T) {
 	cmptest.Assert(t, cmpcobra.New(cmd), "count <TAB>", []string{"one", "two", "three"})
 }
 
+func TestSuggest(t *testing.T) {
+	cp := complete.NopParser(complete.Command{
+		Flags: complete.Flags{
+			"--format": predict.Set("json", "yaml"),
+		},
+	})
+	res := cmptest.Suggest(t, cp, "root --format=y<TAB> --other")
+	if len(res.Suggestions) != 1 || res.Suggestions[0] != "yaml" {
+		t.Fatalf("want [yaml], got %v", res.Suggestions)
+	}
+	if res.Start != 14 || res.End != 15 {
+		t.Fatalf("want the suggestion to replace [14,15), got [%d,%d)", res.Start, res.End)
+	}
+}
+
 func Example() {
 	// Example functions can't actually run tests themselves so leaving this empty.
 	//
@@ -59,4 +74,5 @@ func Example() {
 	_ = TestBasic
 	_ = TestCustomPredictor
 	_ = TestCobra
+	_ = TestSuggest
 }
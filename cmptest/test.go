@@ -25,10 +25,10 @@ const TabMarker = "<TAB>"
 // Assert that the parser returns the correct suggestions given the prompt
 //
 // See the docs for [Suggestions] on how the prompt should look
-func Assert(t *testing.T, cp complete.CommandParser, prompt string, want []string) {
+func Assert(t *testing.T, cp complete.CommandParser, prompt string, want []string, opts ...complete.Option) {
 	t.Helper()
 	t.Run(prompt, func(t *testing.T) {
-		got := Suggestions(t, cp, prompt)
+		got := Suggestions(t, cp, prompt, opts...)
 		if len(got) != len(want) {
 			t.Fatalf("suggestions don't match, want=%v got=%v", want, got)
 		}
@@ -51,38 +51,28 @@ func Assert(t *testing.T, cp complete.CommandParser, prompt string, want []strin
 // used otherwise.
 //
 // Example: "mycli sub --<TAB> --other"
-func Suggestions(t testing.TB, cp complete.CommandParser, prompt string) []string {
+//
+// Completion runs end-to-end, as it would from the shell: through the environment,
+// [complete.Complete.Complete], and what it writes out. Options are given to the
+// completer, such as values for predictors with [complete.Value].
+func Suggestions(t testing.TB, cp complete.CommandParser, prompt string, opts ...complete.Option) []string {
 	t.Helper()
 	internal.SetupLogging()
 
-	// Determine where the cursor is, assuming end of the prompt if tab marker is
-	// missing.
-	var compLine string
-	var compPoint int
-	if ti := strings.Index(prompt, TabMarker); ti != -1 {
-		prompt = prompt[:ti] + prompt[ti+len(TabMarker):]
-		compLine = prompt
-		compPoint = ti
-	} else {
-		compLine = prompt
-		compPoint = len(prompt)
-	}
-
+	compLine, compPoint := cursor(t, prompt)
 	t.Setenv("COMP_LINE", compLine)
 	t.Setenv("COMP_POINT", fmt.Sprint(compPoint))
 
-	// For debugging, point an arrow where the TAB occured
-	t.Logf("COMP_LINE: %q", compLine)
-	pointed := strings.Repeat(" ", compPoint) + "^"
-	t.Logf("COMP_LINE:  %s", pointed)
-	t.Logf("COMP_POINT: %d", compPoint)
-
 	// What would be written to the screen gets written here instead
 	buf := new(bytes.Buffer)
 	w := bufio.NewWriter(buf)
 
-	// 'name' is only used for the install CLI
-	ok := complete.New2F(w, cp).Complete()
+	// The test binary's name won't match the prompt, so treat it as an alias
+	c := complete.New2F(w, cp, opts...)
+	if fields := strings.Fields(compLine); len(fields) > 0 {
+		c.Aliases = []string{fields[0]}
+	}
+	ok := c.Complete()
 	if !ok {
 		t.Fatal("expected completion to run")
 	}
@@ -98,3 +88,36 @@ func Suggestions(t testing.TB, cp complete.CommandParser, prompt string) []strin
 	}
 	return suggestions
 }
+
+// Suggest is like [Suggestions], but completes with [complete.Suggest] as a REPL or
+// TUI would, leaving the environment alone. The result includes where suggestions
+// go in the prompt, and the directive set by predictors.
+//
+// Offsets are for the prompt without the tab marker.
+func Suggest(t testing.TB, cp complete.CommandParser, prompt string, opts ...complete.Option) complete.Result {
+	t.Helper()
+	internal.SetupLogging()
+
+	line, point := cursor(t, prompt)
+	return complete.Suggest(cp, line, point, opts...)
+}
+
+// cursor removes the tab marker from 'prompt', returning where it was
+func cursor(t testing.TB, prompt string) (line string, point int) {
+	t.Helper()
+
+	// Determine where the cursor is, assuming end of the prompt if tab marker is
+	// missing.
+	line, point = prompt, len(prompt)
+	if ti := strings.Index(prompt, TabMarker); ti != -1 {
+		line = prompt[:ti] + prompt[ti+len(TabMarker):]
+		point = ti
+	}
+
+	// For debugging, point an arrow where the TAB occured
+	t.Logf("COMP_LINE: %q", line)
+	pointed := strings.Repeat(" ", point) + "^"
+	t.Logf("COMP_LINE:  %s", pointed)
+	t.Logf("COMP_POINT: %d", point)
+	return line, point
+}
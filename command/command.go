@@ -1,8 +1,10 @@
 package command
 
 import (
+	"slices"
+	"strings"
+
 	"github.com/coxley/complete/args"
-	"github.com/coxley/complete/cmplog"
 	"github.com/coxley/complete/predict"
 )
 
@@ -26,11 +28,36 @@ type Command struct {
 	// args.Args are extra arguments that the command accepts, those who are
 	// given without any flag before.
 	Args predict.Predictor
+
+	// DisableInterspersed stops treating arguments as flags once the first
+	// positional argument, or "--", has been typed. Everything from that point on
+	// is handed to Args untouched.
+	//
+	// This is useful for commands that wrap another program, like
+	// 'mycli exec <cmd> [args...]'. Args receives the positional (when that's what
+	// ended flag parsing) as the first argument so it knows what's being wrapped.
+	DisableInterspersed bool
+
+	// Delegate, when set, is given every argument after this command untouched.
+	// Flags, sub-commands, and Args are ignored.
+	//
+	// This is useful when another program is responsible for completion, like
+	// plugins found by [Plugins].
+	Delegate predict.Predictor
+
+	// Middleware wraps every predictor invoked for this command and its
+	// sub-commands. Middleware of parent commands runs first.
+	Middleware []Middleware
+
+	// Values are attached to [args.Args] for every predictor of this command and its
+	// sub-commands, and read back with [args.Args.Value]. Values of sub-commands
+	// shadow those of their parents.
+	Values map[any]any
 }
 
 // Predict returns all possible predictions for args according to the command struct
 func (c *Command) Predict(a args.Args) []string {
-	options, _ := c.predict(a)
+	options, _ := c.predict(c.describe(a), state{})
 	return options
 }
 
@@ -67,7 +94,26 @@ func (f Flags) Predict(a args.Args) (prediction []string) {
 // only is set to true if no more options are allowed to be returned
 // those are in cases of special flag that has specific completion arguments,
 // and other flags or sub commands can't come after it.
-func (c *Command) predict(a args.Args) (options []string, only bool) {
+func (c *Command) predict(a args.Args, st state) (options []string, only bool) {
+	st.middleware = append(slices.Clip(st.middleware), c.Middleware...)
+	for key, val := range c.Values {
+		a = a.WithValue(key, val)
+	}
+
+	if c.Delegate != nil {
+		a.Log("Predicting according to delegate")
+		return st.call(c.Delegate, "", a), true
+	}
+
+	// once flag parsing has stopped, the remainder belongs to Args alone
+	if i, ok := c.argsStart(a.Completed); ok {
+		a.Log("Flag parsing stopped, predicting remaining args")
+		if c.Args == nil {
+			return nil, true
+		}
+		return st.call(c.Args, "", a.From(i)), true
+	}
+
 	// search sub commands for predictions first
 	subCommandFound := false
 	for i, arg := range a.Completed {
@@ -75,7 +121,7 @@ func (c *Command) predict(a args.Args) (options []string, only bool) {
 			subCommandFound = true
 
 			// recursive call for sub command
-			options, only = cmd.predict(a.From(i))
+			options, only = cmd.predict(a.From(i), st)
 			if only {
 				return
 			}
@@ -88,8 +134,8 @@ func (c *Command) predict(a args.Args) (options []string, only bool) {
 
 	// if last completed word is a global flag that we need to complete
 	if predictor, ok := c.GlobalFlags[a.LastCompleted]; ok && predictor != nil {
-		cmplog.Log("Predicting according to global flag %s", a.LastCompleted)
-		return predictor.Predict(a), true
+		a.Log("Predicting according to global flag %s", a.LastCompleted)
+		return st.call(predictor, a.LastCompleted, a), true
 	}
 
 	options = append(options, c.GlobalFlags.Predict(a)...)
@@ -102,14 +148,71 @@ func (c *Command) predict(a args.Args) (options []string, only bool) {
 
 	// if last completed word is a command flag that we need to complete
 	if predictor, ok := c.Flags[a.LastCompleted]; ok && predictor != nil {
-		cmplog.Log("Predicting according to flag %s", a.LastCompleted)
-		return predictor.Predict(a), true
+		a.Log("Predicting according to flag %s", a.LastCompleted)
+		return st.call(predictor, a.LastCompleted, a), true
 	}
 
 	options = append(options, c.Sub.Predict(a)...)
 	options = append(options, c.Flags.Predict(a)...)
 	if c.Args != nil {
-		options = append(options, c.Args.Predict(a)...)
+		options = append(options, st.call(c.Args, "", a)...)
 	}
 	return
 }
+
+// describe fills in where the user is in the tree, so predictors don't need to
+// work it out again themselves
+//
+// The path of sub-commands is resolved up-front so predictors owned by a parent,
+// like global flags, still see where the user is.
+func (c *Command) describe(a args.Args) args.Args {
+	parsed := c.Parse(a.Completed)
+	a.Path = parsed.Path
+	a.Position = len(parsed.Args)
+	a.FlagValues = parsed.Flags
+	return a
+}
+
+// argsStart returns the index that [args.Args.From] should be given to hand the
+// remaining arguments to Args, when [Command.DisableInterspersed] is set.
+//
+// ok is false if flag parsing hasn't stopped yet, or a sub-command comes first.
+func (c *Command) argsStart(completed []string) (i int, ok bool) {
+	if !c.DisableInterspersed {
+		return 0, false
+	}
+	for i := 0; i < len(completed); i++ {
+		arg := completed[i]
+		switch {
+		case arg == "--":
+			// Drop the separator itself
+			return i, true
+		case strings.HasPrefix(arg, "-"):
+			// Skip the value of flags that expect one, unless given as --flag=value
+			if c.takesValue(arg) {
+				i++
+			}
+		default:
+			if _, ok := c.Sub[arg]; ok {
+				return 0, false
+			}
+			// Keep the positional itself
+			return i - 1, true
+		}
+	}
+	return 0, false
+}
+
+// takesValue returns true if 'flag' is known and expects a separate value
+func (c *Command) takesValue(flag string) bool {
+	if strings.Contains(flag, "=") {
+		return false
+	}
+	if p, ok := c.Flags[flag]; ok {
+		return p != nil
+	}
+	if p, ok := c.GlobalFlags[flag]; ok {
+		return p != nil
+	}
+	return false
+}
@@ -0,0 +1,43 @@
+package command
+
+import (
+	"github.com/coxley/complete/args"
+	"github.com/coxley/complete/predict"
+)
+
+// Invocation describes where in the tree a predictor is being invoked
+type Invocation struct {
+	// Path of sub-commands the user has typed, not including the program itself
+	Path []string
+	// Flag whose value is being completed, or empty for positional arguments
+	Flag string
+}
+
+// Middleware wraps every predictor invocation in a tree, for cross-cutting behavior
+// like timing, auth checks, caching, or filtering suggestions.
+//
+// Call 'next' to get the suggestions it would have returned. Not calling it skips
+// the predictor entirely.
+type Middleware func(inv Invocation, a args.Args, next predict.Predictor) []string
+
+// state is carried down the tree while predicting
+type state struct {
+	middleware []Middleware
+}
+
+// call invokes a predictor from the tree through any middleware, isolating the rest
+// of completion from panics in either
+func (st state) call(p predict.Predictor, flag string, a args.Args) []string {
+	a.Flag = flag
+	inv := Invocation{Path: a.Path, Flag: flag}
+
+	// Wrap in reverse so the first middleware is the outermost
+	next := p
+	for i := len(st.middleware) - 1; i >= 0; i-- {
+		mw, inner := st.middleware[i], next
+		next = predict.Func(func(a args.Args) []string {
+			return mw(inv, a, inner)
+		})
+	}
+	return predict.Recover(next).Predict(a)
+}
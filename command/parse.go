@@ -0,0 +1,115 @@
+package command
+
+import (
+	"maps"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// Parsed is the result of parsing arguments with the schema of a [Command]
+//
+// It gives predictors typed access to what the user has typed, without needing a
+// CLI framework to parse it.
+type Parsed struct {
+	// Path of sub-commands, not including the program itself
+	Path []string
+	// Args are the positional arguments given to the last sub-command
+	Args []string
+	// Flags holds the values given for each flag, keyed by the flag as it's named in
+	// the tree. Flags that don't take a value are given "true".
+	Flags map[string][]string
+}
+
+// Parse 'args', not including the program itself, according to the tree
+//
+// Flags with a nil predictor are treated as booleans, and others take a value. Like
+// completion, parsing is best-effort and never fails.
+func (c *Command) Parse(args []string) *Parsed {
+	parsed := &Parsed{Flags: map[string][]string{}}
+
+	cur := c
+	globals := Flags{}
+	flagsDone := false
+	for i := 0; i < len(args) && cur.Delegate == nil; i++ {
+		arg := args[i]
+		if !flagsDone && arg == "--" {
+			flagsDone = true
+			continue
+		}
+
+		if !flagsDone && len(arg) > 1 && strings.HasPrefix(arg, "-") {
+			name, value, hasValue := strings.Cut(arg, "=")
+			p, known := cur.Flags[name]
+			if !known {
+				p, known = cur.GlobalFlags[name]
+			}
+			if !known {
+				p, known = globals[name]
+			}
+
+			switch {
+			case hasValue:
+			case known && p == nil:
+				value = "true"
+			case known && i+1 == len(args):
+				// The value hasn't been typed yet
+				continue
+			case known:
+				i++
+				value = args[i]
+			}
+			parsed.Flags[name] = append(parsed.Flags[name], value)
+			continue
+		}
+
+		if sub, ok := cur.Sub[arg]; ok && !flagsDone {
+			maps.Copy(globals, cur.GlobalFlags)
+			parsed.Path = append(parsed.Path, arg)
+			parsed.Args = nil
+			cur = &sub
+			continue
+		}
+
+		parsed.Args = append(parsed.Args, arg)
+		if cur.DisableInterspersed {
+			flagsDone = true
+		}
+	}
+	return parsed
+}
+
+// Strings returns every value given for 'flag'
+//
+// The flag can be named as it is in the tree, like "--env", or without hyphens.
+func (p *Parsed) Strings(flag string) []string {
+	for _, name := range []string{flag, "--" + flag, "-" + flag} {
+		if values, ok := p.Flags[name]; ok {
+			return slices.Clone(values)
+		}
+	}
+	return nil
+}
+
+// String returns the last value given for 'flag', or empty if it wasn't given
+func (p *Parsed) String(flag string) string {
+	values := p.Strings(flag)
+	if len(values) == 0 {
+		return ""
+	}
+	return values[len(values)-1]
+}
+
+// Bool returns true if 'flag' was given, and its last value wasn't false
+func (p *Parsed) Bool(flag string) bool {
+	values := p.Strings(flag)
+	if len(values) == 0 {
+		return false
+	}
+	b, err := strconv.ParseBool(values[len(values)-1])
+	if err != nil {
+		// Given without a value we understand, like an unknown flag
+		return true
+	}
+	return b
+}
@@ -0,0 +1,71 @@
+package command
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/coxley/complete/cmplog"
+	"github.com/coxley/complete/predict"
+)
+
+// Plugins scans PATH for executables named '<prefix><name>', returning them as
+// sub-commands keyed by '<name>'. This follows the same convention as git and
+// kubectl plugins.
+//
+// Completion under a plugin is forwarded to it with [predict.DelegateTo], so
+// plugins should be self-completing. Earlier entries in PATH take precedence, the
+// same as when running them.
+func Plugins(prefix string) Commands {
+	plugins := Commands{}
+	for _, dir := range filepath.SplitList(os.Getenv("PATH")) {
+		if dir == "" {
+			dir = "."
+		}
+		entries, err := os.ReadDir(dir)
+		if err != nil {
+			continue
+		}
+
+		for _, e := range entries {
+			name, ok := strings.CutPrefix(e.Name(), prefix)
+			if !ok || name == "" {
+				continue
+			}
+			if _, ok := plugins[name]; ok {
+				continue
+			}
+
+			path := filepath.Join(dir, e.Name())
+			if !isExecutable(path) {
+				continue
+			}
+			cmplog.Log("Found plugin %q at %s", name, path)
+			plugins[name] = Command{Delegate: predict.DelegateTo(path)}
+		}
+	}
+	return plugins
+}
+
+// AddPlugins adds [Plugins] found for 'prefix' as sub-commands. Compiled-in
+// sub-commands with the same name are kept.
+func (c *Command) AddPlugins(prefix string) {
+	if c.Sub == nil {
+		c.Sub = Commands{}
+	}
+	for name, plugin := range Plugins(prefix) {
+		if _, ok := c.Sub[name]; ok {
+			continue
+		}
+		c.Sub[name] = plugin
+	}
+}
+
+func isExecutable(path string) bool {
+	// Follow symlinks so linked plugins are found
+	info, err := os.Stat(path)
+	if err != nil {
+		return false
+	}
+	return info.Mode().IsRegular() && info.Mode().Perm()&0o111 != 0
+}
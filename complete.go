@@ -1,30 +1,67 @@
 package complete
 
 import (
+	"cmp"
 	"fmt"
 	"io"
+	"log"
+	"maps"
 	"os"
+	"path/filepath"
+	"slices"
 	"strconv"
 	"strings"
+	"sync"
+	"time"
+	"unicode"
 
 	"github.com/coxley/complete/args"
 	"github.com/coxley/complete/cmplog"
 	"github.com/coxley/complete/command"
 	"github.com/coxley/complete/internal/install"
+	"github.com/coxley/complete/predict"
 )
 
 const (
-	envLine  = "COMP_LINE"
-	envPoint = "COMP_POINT"
+	envLine       = "COMP_LINE"
+	envPoint      = "COMP_POINT"
+	envWordbreaks = "COMP_WORDBREAKS"
+	envType       = "COMP_TYPE"
+	// envCommandLine is set by tcsh instead of COMP_LINE and COMP_POINT
+	envCommandLine = "COMMAND_LINE"
 )
 
 var Log = cmplog.Log
 
 // Complete structs define completion for a command with CLI options
 type Complete struct {
+	// Command is the tree being completed. When given a parser made by [Lazy], it's
+	// left empty until completion needs it.
 	Command Command
 	Out     io.Writer
 	Parser  args.Parser
+
+	// Names maps each name a multi-call binary can be invoked as to its own tree. When
+	// set, Command and Parser are ignored. See [NewMulti].
+	Names map[string]CommandParser
+
+	// Encoding of suggestions written to Out. Installed scripts may ask for a
+	// different one.
+	Encoding Encoding
+
+	// Aliases are other names the program may be completed as, such as a shell alias.
+	//
+	// COMP_LINE is only acted on when its first word matches os.Args[0], the command
+	// name bash gives as the first argument, a name in Names, or an alias. Otherwise
+	// it was inherited from a parent process being completed, and is ignored.
+	Aliases []string
+
+	options options
+	// cp builds Command on first use, when given a [Lazy] parser
+	cp CommandParser
+	// logf receives logs while completing, when set by [Logger] or COMP_DEBUG. It's
+	// handed to predictors through Args rather than replacing [cmplog.Log].
+	logf func(format string, args ...any)
 }
 
 // Commander returns a structured [Command]
@@ -44,6 +81,26 @@ func NopParser(command command.Command) CommandParser {
 	return &nopParser{command}
 }
 
+// Lazy returns a [CommandParser] built by 'fn' the first time it's needed
+//
+// Combined with [IsRequest], programs can avoid constructing large trees, and the
+// dependencies their predictors need, unless completion was requested.
+func Lazy(fn func() CommandParser) CommandParser {
+	return &lazyParser{get: sync.OnceValue(fn)}
+}
+
+type lazyParser struct {
+	get func() CommandParser
+}
+
+func (p *lazyParser) Parse(args []string) any {
+	return p.get().Parse(args)
+}
+
+func (p *lazyParser) Command() command.Command {
+	return p.get().Command()
+}
+
 type nopParser struct {
 	command Command
 }
@@ -56,6 +113,27 @@ func (p *nopParser) Command() command.Command {
 	return p.command
 }
 
+// SchemaParser returns a [CommandParser] that parses arguments using the tree itself,
+// for programs that don't use a CLI framework.
+//
+// Predictors find a [*command.Parsed] in [args.Args.Root], giving typed access
+// to flag values and positional arguments.
+func SchemaParser(command command.Command) CommandParser {
+	return &schemaParser{command}
+}
+
+type schemaParser struct {
+	command Command
+}
+
+func (p *schemaParser) Parse(args []string) any {
+	return p.command.Parse(args)
+}
+
+func (p *schemaParser) Command() command.Command {
+	return p.command
+}
+
 // New creates a new complete command.
 //
 // 'name' is unused, but is kept for backward-compatibility with posener/complete. It
@@ -65,54 +143,237 @@ func New(name string, command command.Command) *Complete {
 	return &Complete{
 		Command: command,
 		Out:     os.Stdout,
+		options: newOptions(nil),
 	}
 }
 
 // New2 returns a completer structured by the [CommandParser]
 //
 // By accepting an [args.Parser], predictors can gain extra insight to the command
-// at large to influence their suggestions. The result of [args.Parser.Parse] is stored in
-// [args.Args.ParsedRoot] before any predictors run.
+// at large to influence their suggestions. The result of [args.Parser.Parse] is returned
+// by [args.Args.Root]. With [LazyParse], parsing waits until a predictor asks for it.
 //
 // Suggestions are printed to [os.Stdout].
-func New2(cp CommandParser) *Complete {
-	return New2F(os.Stdout, cp)
+func New2(cp CommandParser, opts ...Option) *Complete {
+	return New2F(os.Stdout, cp, opts...)
 }
 
 // New2F returns a completer that writes suggestions to 'w'
-func New2F(w io.Writer, cp CommandParser) *Complete {
+func New2F(w io.Writer, cp CommandParser, opts ...Option) *Complete {
+	o := newOptions(opts)
+	c := &Complete{
+		Out:      w,
+		Parser:   cp,
+		Encoding: o.encoding,
+		options:  o,
+	}
+	if _, ok := cp.(*lazyParser); ok {
+		c.cp = cp
+	} else {
+		c.Command = cp.Command()
+	}
+	return c
+}
+
+// NewMulti returns a completer for multi-call binaries, like busybox, where the
+// program behaves differently depending on the name it's invoked as.
+//
+// The tree is chosen by the first word of the prompt, falling back to the name in
+// os.Args[0]. Installing completion registers every name in 'names'.
+//
+// Suggestions are printed to [os.Stdout].
+func NewMulti(names map[string]CommandParser, opts ...Option) *Complete {
+	return NewMultiF(os.Stdout, names, opts...)
+}
+
+// NewMultiF returns a multi-call completer that writes suggestions to 'w'
+func NewMultiF(w io.Writer, names map[string]CommandParser, opts ...Option) *Complete {
+	o := newOptions(opts)
 	return &Complete{
-		Command: cp.Command(),
-		Out:     w,
-		Parser:  cp,
+		Out:      w,
+		Names:    names,
+		Encoding: o.encoding,
+		options:  o,
 	}
 }
 
 // Complete determines if the user needs suggestions, and returns true if so. Programs
 // should exit when true.
 //
+// Completion scripts installed by this package invoke the program with a hidden
+// sub-command, '__complete', describing what to complete. Otherwise the COMP_LINE
+// protocol used by 'complete -C' in bash is understood.
+//
 // Environment variables that control our logic:
 //
 //   - COMP_LINE: prompt of the user
 //   - COMP_POINT: cursor position wher tab was pressed
+//   - COMMAND_LINE: prompt of the user up to the cursor, set by tcsh
 //   - COMP_INSTALL=1: install completion script into the user's shell
 //   - COMP_UNINSTALL=1: uninstall completion script from the user's shell
 //   - COMP_YES=1: don't prompt when installing or uninstall
+//   - COMP_SERVE: socket to serve completions on, see [Server]
+//   - COMP_GENERATE=<shell>: write a static script for bash, zsh, or fish, see [Generate]
+//
+// See [EnvPrefix] to rename the ones we control.
+//
+// COMP_LINE, COMP_POINT, and COMMAND_LINE are removed from the environment once read so child
+// processes don't inherit them. Predictors can use [predict.CleanEnv] to be explicit.
 func (c *Complete) Complete() bool {
+	c.logf = c.options.logger
+	if c.logf == nil && os.Getenv(c.env("DEBUG")) != "" && os.Getenv(cmplog.Env) == "" {
+		c.logf = log.New(os.Stderr, "complete ", log.Flags()).Printf
+	}
+	if sock := os.Getenv(c.env("SERVE")); sock != "" && c.options.server {
+		if err := c.runServer(sock); err != nil {
+			c.log("Completion server failed: %v", err)
+		}
+		return true
+	}
+
 	// Install (or uninstall) completion into the user's shell if requested
-	doInstall := os.Getenv("COMP_INSTALL") == "1"
-	doUninstall := os.Getenv("COMP_UNINSTALL") == "1"
-	autoYes := os.Getenv("COMP_YES") == "1"
-	if doInstall || doUninstall {
-		install.Run(os.Args[0], doUninstall, autoYes, os.Stdout, os.Stdin)
+	doInstall := os.Getenv(c.env("INSTALL")) == "1"
+	doUninstall := os.Getenv(c.env("UNINSTALL")) == "1"
+	autoYes := os.Getenv(c.env("YES")) == "1"
+	if (doInstall || doUninstall) && !c.options.disableInstall {
+		opts := install.Options{LegacyBash: c.options.legacyBash}
+		install.Run(c.installNames(), doUninstall, autoYes, opts, os.Stdout, os.Stdin)
+		return true
+	}
+
+	// Write a static script to stdout if requested
+	if shell := os.Getenv(c.env("GENERATE")); shell != "" {
+		bin, err := install.BinaryPath()
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "generate failed: %s\n", err)
+			os.Exit(1)
+		}
+		for _, name := range c.installNames() {
+			cmd, _, _ := c.tree(name)
+			// Predictors wrapped by Use need the program, like any middleware
+			if len(c.options.middleware) > 0 {
+				cmd.Middleware = append(slices.Clip(c.options.middleware), cmd.Middleware...)
+			}
+			if err := Generate(c.Out, shell, name, bin, cmd); err != nil {
+				fmt.Fprintf(os.Stderr, "generate failed: %s\n", err)
+				os.Exit(1)
+			}
+		}
 		return true
 	}
 
-	line, point, ok := getEnv()
+	req, ok := c.request()
 	if !ok {
 		return false
 	}
+	enc := c.Encoding
+	if req.encoding != nil {
+		enc = *req.encoding
+	}
+
+	if c.options.server {
+		if comp, ok := c.remote(req); ok {
+			c.output(comp, req.format(enc))
+			return true
+		}
+	}
+
+	cmd, parser, ok := c.tree(req.line)
+	if !ok {
+		c.log("No completion tree for phrase: %s", req.line)
+		return true
+	}
+
+	c.output(c.suggest(cmd, parser, req), req.format(enc))
+	return true
+}
+
+// Generate writes a completion script for 'shell' with 'cmd' written into it, for
+// hosts where running the program on every TAB is too slow
+//
+// Sub-commands, flags, [predict.Set] values, and [predict.Files] or [predict.Dirs]
+// are completed by the shell alone. Other predictors, and commands with a delegate,
+// middleware, or [Command.DisableInterspersed], still run 'bin', or 'name' from PATH
+// if it's empty.
+//
+// Middleware given to [Use] isn't known here. Add it to cmd.Middleware so it runs,
+// which leaves the whole tree to the program. Through COMP_GENERATE, that's done for
+// you.
+//
+// The supported shells are bash, zsh, and fish.
+func Generate(w io.Writer, shell, name, bin string, cmd Command) error {
+	script, err := install.Static(shell, name, bin, cmd)
+	if err != nil {
+		return err
+	}
+	_, err = io.WriteString(w, script)
+	return err
+}
+
+// Result of completing a line with [Suggest]
+type Result struct {
+	Suggestions []string
+	// Start and End are the byte offsets of the text in the line that a suggestion
+	// should replace
+	Start, End int
+	// Directive set by the predictors, or implied by the suggestions, like
+	// [args.DirectiveNoSpace] for '--flag='
+	Directive args.Directive
+}
+
+// Suggest returns the suggestions for 'line', as if the user pressed TAB at byte
+// offset 'point'. A point outside of the line means the end of it.
+//
+// This is for programs that complete their own input, like a REPL or TUI. Unlike
+// [Complete.Complete], the environment and stdout are left alone.
+func Suggest(cp CommandParser, line string, point int, opts ...Option) Result {
+	c := &Complete{options: newOptions(opts)}
+	c.logf = c.options.logger
+
+	comp := c.suggest(cp.Command(), cp, request{line: line, point: point})
+	var res Result
+	for _, match := range comp.Matches {
+		value, _ := splitDescription(match)
+		clean, err := sanitize(value, c.options.encoding)
+		if err != nil {
+			c.log("Dropping suggestion %q: %v", match, err)
+			continue
+		}
+		res.Suggestions = append(res.Suggestions, clean)
+	}
 
+	res.End = point
+	if point < 0 || point > len(line) {
+		res.End = len(line)
+	}
+	// The word being completed always ends where the line was cut
+	res.Start = res.End - len(comp.Last)
+	res.Directive = comp.Directive
+	return res
+}
+
+// completion holds the suggestions for a line, before they're written out
+type completion struct {
+	Matches []string `json:"matches"`
+	// Last is the word being completed, and Word the whitespace-separated field it's
+	// part of. They differ for arguments like '--flag=value'.
+	Last      string         `json:"last"`
+	Word      string         `json:"word"`
+	Directive args.Directive `json:"directive"`
+}
+
+// suggest returns the suggestions matching the word at the cursor
+func (c *Complete) suggest(cmd Command, parser args.Parser, req request) completion {
+	if c.options.lazyParse {
+		parser = args.Lazy(parser)
+	}
+	if req.words != nil {
+		c.log("Completing words: %q", req.words)
+		word := req.words[len(req.words)-1]
+		return c.match(cmd, req.withDir(args.NewWords(req.words, parser)), word)
+	}
+
+	line, point := req.line, req.point
 	// TODO: Remove. Ideally, we want the full context of what the shell sent us for
 	// optimal enrichment, but we may need framework-specific logic for parsing to get
 	// there.
@@ -123,45 +384,167 @@ func (c *Complete) Complete() bool {
 		line = line[:point]
 	}
 
-	Log("Completing phrase: %s", line)
-	a := args.New(line, c.Parser)
-	Log("Completing last field: %s", a.Last)
-	options := c.Command.Predict(a)
-	Log("Options: %s", options)
+	c.log("Completing phrase: %s", line)
+	word := line[strings.LastIndexFunc(line, unicode.IsSpace)+1:]
+	return c.match(cmd, req.withDir(args.New(line, parser)), word)
+}
+
+// match runs the predictors, keeping the suggestions that match the word being
+// completed. 'word' is the whole field that's part of.
+func (c *Complete) match(cmd Command, a args.Args, word string) completion {
+	for key, val := range c.options.values {
+		a = a.WithValue(key, val)
+	}
+	if c.logf != nil {
+		a = a.WithLogger(c.logf)
+	}
+	if c.options.cacheDir != nil {
+		a = predict.WithCacheDir(a, c.options.cacheDir)
+	}
+	c.log("Completing last field: %s", a.Last)
+	options := c.predict(cmd, a)
+	c.log("Options: %s", options)
 
 	// filter only options that match the last argument
-	//
-	// TODO: Adjust logic so that predictors can control what is matched vs. always
-	// prefix based.
+	match := c.options.match
+	if match == nil {
+		match = MatchPrefix
+	}
 	matches := []string{}
+	directive := a.Directive()
 	for _, option := range options {
-		if strings.HasPrefix(option, a.Last) {
-			matches = append(matches, option)
+		value, _ := splitDescription(option)
+		if !match(value, a.Last) {
+			continue
+		}
+		matches = append(matches, option)
+
+		// The user has more to type, like the value of '--flag=' or a path
+		if strings.HasSuffix(value, "=") || strings.HasSuffix(value, "/") {
+			directive |= args.DirectiveNoSpace
 		}
 	}
-	Log("Matches: %s", matches)
-	c.output(matches)
-	return true
+	if limit := c.options.maxSuggestions; limit > 0 && len(matches) > limit {
+		c.log("Limiting %d matches to %d", len(matches), limit)
+		slices.Sort(matches)
+		matches = matches[:limit]
+	}
+	c.log("Matches: %s", matches)
+	return completion{Matches: matches, Last: a.Last, Word: word, Directive: directive}
 }
 
-func getEnv() (line string, point int, ok bool) {
-	line = os.Getenv(envLine)
-	if line == "" {
+// predict runs the predictors for 'cmd', giving up after the configured timeout
+//
+// Predictors that time out are left running, since they can't be stopped. They're
+// given their own directives, so that setting them later doesn't touch 'a'.
+func (c *Complete) predict(cmd Command, a args.Args) []string {
+	if len(c.options.middleware) > 0 {
+		cmd.Middleware = append(slices.Clip(c.options.middleware), cmd.Middleware...)
+	}
+
+	if c.options.timeout <= 0 {
+		return cmd.Predict(a)
+	}
+
+	// Buffered so the predictors can finish without a reader after timing out
+	done := make(chan []string, 1)
+	inner := a.WithDirective(a.Directive())
+	go func() {
+		done <- cmd.Predict(inner)
+	}()
+
+	select {
+	case options := <-done:
+		a.SetDirective(inner.Directive())
+		return options
+	case <-time.After(c.options.timeout):
+		c.log("Predictors timed out after %s", c.options.timeout)
+		return nil
+	}
+}
+
+// env returns the name of one of the environment variables we control
+func (c *Complete) env(name string) string {
+	return cmp.Or(c.options.envPrefix, "COMP_") + name
+}
+
+// log writes to the logger for this completion, or [Log] if there isn't one
+func (c *Complete) log(format string, args ...any) {
+	if c.logf != nil {
+		c.logf(format, args...)
 		return
 	}
+	Log(format, args...)
+}
+
+// installNames returns the names completion is installed, or generated, for
+func (c *Complete) installNames() []string {
+	switch {
+	case len(c.options.installNames) > 0:
+		return c.options.installNames
+	case len(c.Names) > 0:
+		return slices.Sorted(maps.Keys(c.Names))
+	}
+	return []string{os.Args[0]}
+}
+
+// tree returns the command and parser to complete 'line' with
+//
+// For multi-call binaries, this depends on the name the program was invoked as.
+func (c *Complete) tree(line string) (Command, args.Parser, bool) {
+	if len(c.Names) == 0 {
+		if c.cp != nil {
+			// Built on first use, so programs that aren't being completed don't pay
+			c.Command, c.cp = c.cp.Command(), nil
+		}
+		return c.Command, c.Parser, true
+	}
+
+	var first string
+	if fields := strings.Fields(line); len(fields) > 0 {
+		first = fields[0]
+	}
+	for _, name := range []string{first, os.Args[0]} {
+		if cp, ok := c.Names[filepath.Base(name)]; ok {
+			return cp.Command(), cp, true
+		}
+	}
+	return Command{}, nil, false
+}
+
+// isSelf returns true if 'line' is being completed for this program
+func (c *Complete) isSelf(line string) bool {
+	fields := strings.Fields(line)
+	if len(fields) == 0 {
+		return true
+	}
+
+	names := append([]string{os.Args[0]}, c.Aliases...)
+	names = slices.AppendSeq(names, maps.Keys(c.Names))
+	// Shells using 'complete -C' pass the command name as the first argument
+	if len(os.Args) > 1 {
+		names = append(names, os.Args[1])
+	}
+
+	first := filepath.Base(fields[0])
+	return slices.ContainsFunc(names, func(name string) bool {
+		return filepath.Base(name) == first
+	})
+}
+
+func (c *Complete) getEnv() (req request, ok bool) {
+	line := os.Getenv(envLine)
+	if line == "" {
+		// tcsh only gives the line up to the cursor
+		line = os.Getenv(envCommandLine)
+		return request{line: line, point: len(line), shell: "tcsh"}, line != ""
+	}
 	point, err := strconv.Atoi(os.Getenv(envPoint))
 	if err != nil {
 		// If failed parsing point for some reason, set it to point
 		// on the end of the line.
-		Log("Failed parsing point %s: %v", os.Getenv(envPoint), err)
+		c.log("Failed parsing point %s: %v", os.Getenv(envPoint), err)
 		point = len(line)
 	}
-	return line, point, true
-}
-
-func (c *Complete) output(options []string) {
-	// stdout of program defines the complete options
-	for _, option := range options {
-		fmt.Fprintln(c.Out, option)
-	}
+	return request{line: line, point: point}, true
 }
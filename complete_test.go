@@ -3,12 +3,19 @@ package complete
 import (
 	"bytes"
 	"fmt"
+	"io"
+	"maps"
 	"os"
+	"path/filepath"
+	"slices"
 	"sort"
 	"strconv"
 	"strings"
 	"testing"
+	"time"
 
+	"github.com/coxley/complete/args"
+	"github.com/coxley/complete/command"
 	"github.com/coxley/complete/internal"
 )
 
@@ -375,6 +382,934 @@ func TestCompleter_Complete_SharedPrefix(t *testing.T) {
 	}
 }
 
+func TestCompleter_Complete_DisableInterspersed(t *testing.T) {
+	internal.Chdir(t)
+
+	// Echo back what the wrapped command would be given, prefixed by what's being
+	// typed so it isn't filtered out
+	echo := PredictFunc(func(a Args) []string {
+		return []string{a.Last + "|" + strings.Join(a.Completed, ",")}
+	})
+
+	c := Command{
+		Sub: Commands{
+			"exec": {
+				Flags: Flags{
+					"-e":  PredictSet("prod", "dev"),
+					"-rm": PredictNothing,
+				},
+				Args:                echo,
+				DisableInterspersed: true,
+			},
+		},
+	}
+
+	cmp := New("cmd", c)
+
+	tests := []struct {
+		line string
+		want []string
+	}{
+		{
+			line: "cmd exec -",
+			want: []string{"-e", "-rm", "-|"},
+		},
+		{
+			line: "cmd exec -e ",
+			want: []string{"prod", "dev"},
+		},
+		{
+			line: "cmd exec -e prod -rm ",
+			want: []string{"|-e,prod,-rm"},
+		},
+		{
+			line: "cmd exec kubectl ",
+			want: []string{"|kubectl"},
+		},
+		{
+			line: "cmd exec -e prod kubectl get -",
+			want: []string{"-|kubectl,get"},
+		},
+		{
+			line: "cmd exec -rm -- kubectl -e ",
+			want: []string{"|kubectl,-e"},
+		},
+		{
+			line: "cmd exec kubectl -- -",
+			want: []string{"-|kubectl,--"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.line, func(t *testing.T) {
+			got := runComplete(cmp, tt.line, -1)
+
+			sort.Strings(tt.want)
+			sort.Strings(got)
+
+			if !equalSlices(got, tt.want) {
+				t.Errorf("failed '%s'\ngot = %s\nwant: %s", t.Name(), got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCompleter_Complete_Plugins(t *testing.T) {
+	internal.Chdir(t)
+
+	// Plugins echo back the current word, their own name, and the previous word
+	dir := t.TempDir()
+	script := "#!/bin/sh\necho \"$2:$1:$3\"\n"
+	for _, name := range []string{"cmd-foo", "cmd-status", "other-bar"} {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(script), 0o755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	t.Setenv("PATH", dir)
+
+	c := Command{
+		Sub: Commands{
+			"status": {
+				Flags: Flags{"-v": PredictNothing},
+			},
+		},
+	}
+	c.AddPlugins("cmd-")
+	cmp := New("cmd", c)
+
+	tests := []struct {
+		line string
+		want []string
+	}{
+		{
+			line: "cmd ",
+			want: []string{"foo", "status"},
+		},
+		{
+			line: "cmd foo ",
+			want: []string{":cmd-foo:cmd-foo"},
+		},
+		{
+			line: "cmd foo --bar b",
+			want: []string{"b:cmd-foo:--bar"},
+		},
+		{
+			// Compiled-in commands aren't replaced
+			line: "cmd status -",
+			want: []string{"-v"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.line, func(t *testing.T) {
+			got := runComplete(cmp, tt.line, -1)
+
+			sort.Strings(tt.want)
+			sort.Strings(got)
+
+			if !equalSlices(got, tt.want) {
+				t.Errorf("failed '%s'\ngot = %s\nwant: %s", t.Name(), got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCompleter_Complete_NotSelf(t *testing.T) {
+	cmp := New("cmd", Command{Sub: Commands{"sub": {}}})
+	cmp.Out = io.Discard
+
+	// Inherited from a parent being completed
+	t.Setenv(envLine, "other-program ")
+	t.Setenv(envPoint, "14")
+	if cmp.Complete() {
+		t.Errorf("completed for another program's %s", envLine)
+	}
+
+	// And then shouldn't be passed on further
+	if _, ok := os.LookupEnv(envLine); ok {
+		t.Errorf("%s still set", envLine)
+	}
+}
+
+func TestCompleter_Complete_Tcsh(t *testing.T) {
+	internal.Chdir(t)
+
+	tests := []struct {
+		line string
+		want []string
+	}{
+		{line: "cmd su", want: []string{"sub1", "sub2"}},
+		// tcsh matches the whole word, so the flag is kept
+		{line: "cmd --out=j", want: []string{"--out=json"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.line, func(t *testing.T) {
+			b := new(bytes.Buffer)
+			cmp := New("cmd", Command{
+				Sub:   Commands{"sub1": {}, "sub2": {}, "other": {}},
+				Flags: Flags{"--out": PredictSet("json", "yaml")},
+			})
+			cmp.Out = b
+			cmp.Aliases = []string{"cmd"}
+
+			t.Setenv(envLine, "")
+			t.Setenv(envCommandLine, tt.line)
+			if !cmp.Complete() {
+				t.Fatalf("didn't complete %s", envCommandLine)
+			}
+			got := parseOutput(b.String())
+			sort.Strings(got)
+			if !equalSlices(got, tt.want) {
+				t.Errorf("got %v, want %v", got, tt.want)
+			}
+			if _, ok := os.LookupEnv(envCommandLine); ok {
+				t.Errorf("%s still set", envCommandLine)
+			}
+		})
+	}
+}
+
+func TestCompleter_Complete_Multi(t *testing.T) {
+	internal.Chdir(t)
+
+	cmp := NewMulti(map[string]CommandParser{
+		"mycli": NopParser(Command{
+			Sub: Commands{"status": {}, "deploy": {}},
+		}),
+		"mycli-admin": NopParser(Command{
+			Sub: Commands{"users": {}, "quota": {}},
+		}),
+	})
+
+	tests := []struct {
+		line string
+		want []string
+	}{
+		{
+			line: "mycli ",
+			want: []string{"status", "deploy"},
+		},
+		{
+			line: "mycli-admin ",
+			want: []string{"users", "quota"},
+		},
+		{
+			line: "./bin/mycli-admin q",
+			want: []string{"quota"},
+		},
+		{
+			line: "unknown ",
+			want: []string{},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.line, func(t *testing.T) {
+			got := runComplete(cmp, tt.line, -1)
+
+			sort.Strings(tt.want)
+			sort.Strings(got)
+
+			if !equalSlices(got, tt.want) {
+				t.Errorf("failed '%s'\ngot = %s\nwant: %s", t.Name(), got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCompleter_Complete_Generate(t *testing.T) {
+	b := new(bytes.Buffer)
+	cmp := NewMultiF(b, map[string]CommandParser{
+		"mycli":       NopParser(Command{Sub: Commands{"status": {}}}),
+		"mycli-admin": NopParser(Command{Sub: Commands{"quota": {}}}),
+	})
+
+	t.Setenv("COMP_GENERATE", "bash")
+	if !cmp.Complete() {
+		t.Fatal("didn't generate")
+	}
+
+	// Each name gets a script for its own tree
+	for _, want := range []string{
+		"complete -F _mycli_static mycli\n",
+		"complete -F _mycli_admin_static mycli-admin\n",
+		"vals=('status')",
+		"vals=('quota')",
+	} {
+		if !strings.Contains(b.String(), want) {
+			t.Errorf("missing %q in:\n%s", want, b.String())
+		}
+	}
+
+	// Predictors run through this binary, and middleware needs it for everything
+	exe, err := os.Executable()
+	if err != nil {
+		t.Fatal(err)
+	}
+	b.Reset()
+	mw := func(_ command.Invocation, a Args, next Predictor) []string { return next.Predict(a) }
+	cmp = New2F(b, NopParser(Command{Sub: Commands{"status": {}}}), Use(mw), InstallNames("mycli"))
+	if !cmp.Complete() {
+		t.Fatal("didn't generate")
+	}
+	for _, want := range []string{"'" + exe + "' __complete", "'')\n        dynamic=1"} {
+		if !strings.Contains(b.String(), want) {
+			t.Errorf("missing %q in:\n%s", want, b.String())
+		}
+	}
+	if strings.Contains(b.String(), "status") {
+		t.Errorf("sub-commands written despite middleware:\n%s", b.String())
+	}
+}
+
+func TestCompleter_Complete_Subcommand(t *testing.T) {
+	internal.Chdir(t)
+	cmp := New("cmd", Command{
+		Sub: Commands{
+			"sub1": {Flags: Flags{"-flag1": PredictNothing}},
+			"sub2": {Flags: Flags{"-o": PredictSet("json", "yaml")}},
+		},
+	})
+
+	tests := []struct {
+		argv []string
+		want []string
+	}{
+		{
+			// zsh and fish match the whole word, so the flag is kept
+			argv: []string{"__complete", "--protocol", "1", "--shell", "zsh", "--", "cmd", "sub2", "-o=j"},
+			want: []string{"-o=json"},
+		},
+		{
+			argv: []string{"__complete", "--protocol", "1", "--shell", "fish", "--", "cmd", "sub2", "-o=j"},
+			want: []string{"-o=json"},
+		},
+		{
+			argv: []string{"__complete", "--protocol", "1", "--shell", "zsh", "--", "cmd", ""},
+			want: []string{"sub1", "sub2"},
+		},
+		{
+			argv: []string{"__complete", "--protocol", "1", "--shell", "fish", "--", "cmd", "sub1", "-"},
+			want: []string{"-flag1"},
+		},
+		{
+			// Cursor after 'sub' in the line as typed
+			argv: []string{"__complete", "--point", "7", "--", "cmd sub1 -"},
+			want: []string{"sub1", "sub2"},
+		},
+		{
+			// Words split by the shell stay whole, so this isn't 'sub1'
+			argv: []string{"__complete", "--protocol", "1", "--shell", "fish", "--", "cmd", "sub1 x", "-"},
+			want: []string{},
+		},
+		{
+			// Newer scripts may pass flags we don't know, still do our best
+			argv: []string{"__complete", "--protocol", "99", "--unknown", "--", "cmd", "sub2"},
+			want: []string{"sub2"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(strings.Join(tt.argv, " "), func(t *testing.T) {
+			oldArgs := os.Args
+			defer func() { os.Args = oldArgs }()
+			os.Args = append([]string{"/path/to/cmd"}, tt.argv...)
+
+			b := bytes.NewBuffer(nil)
+			cmp.Out = b
+			if !cmp.Complete() {
+				t.Fatal("expected completion to run")
+			}
+			got := parseOutput(b.String())
+
+			sort.Strings(tt.want)
+			sort.Strings(got)
+
+			if !equalSlices(got, tt.want) {
+				t.Errorf("failed '%s'\ngot = %s\nwant: %s", t.Name(), got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCompleter_Complete_Panic(t *testing.T) {
+	internal.Chdir(t)
+
+	panics := PredictFunc(func(Args) []string {
+		panic("oops")
+	})
+	cmp := New("cmd", Command{
+		Sub:   Commands{"sub": {}},
+		Flags: Flags{"-f": panics},
+		Args:  panics,
+	})
+
+	got := runComplete(cmp, "cmd ", -1)
+	if !equalSlices(got, []string{"sub"}) {
+		t.Errorf("got = %s, want: [sub]", got)
+	}
+
+	got = runComplete(cmp, "cmd -f ", -1)
+	if len(got) != 0 {
+		t.Errorf("got = %s, want: []", got)
+	}
+}
+
+func TestCompleter_Predict_Timeout(t *testing.T) {
+	release := make(chan struct{})
+	finished := make(chan struct{})
+	c := Command{
+		Flags: Flags{
+			"-slow": PredictFunc(func(a Args) []string {
+				<-release
+				a.SetDirective(args.DirectiveNoSpace)
+				close(finished)
+				return []string{"late"}
+			}),
+			"-fast": PredictFunc(func(a Args) []string {
+				a.SetDirective(args.DirectiveFilenames)
+				return []string{"now"}
+			}),
+		},
+	}
+	cmp := New2(NopParser(c), Timeout(10*time.Millisecond))
+
+	// Directives from predictors that return in time are kept
+	a := args.New("cmd -fast ", nil)
+	if got := cmp.predict(c, a); !equalSlices(got, []string{"now"}) {
+		t.Errorf("got = %s, want: [now]", got)
+	}
+	if got := a.Directive(); got != args.DirectiveFilenames {
+		t.Errorf("directive = %d, want: %d", got, args.DirectiveFilenames)
+	}
+
+	// The abandoned predictor still runs, but can't reach the caller's directives
+	a = args.New("cmd -slow ", nil)
+	if got := cmp.predict(c, a); len(got) != 0 {
+		t.Errorf("got = %s, want: []", got)
+	}
+	close(release)
+	<-finished
+	if got := a.Directive(); got != 0 {
+		t.Errorf("directive = %d, want: 0", got)
+	}
+}
+
+func TestCompleter_Complete_Options(t *testing.T) {
+	internal.Chdir(t)
+
+	c := Command{
+		Sub: Commands{"Status": {}, "stop": {}, "start": {}},
+		Flags: Flags{
+			"-slow": PredictFunc(func(Args) []string {
+				time.Sleep(time.Second)
+				return []string{"late"}
+			}),
+			"-log": PredictFunc(func(a Args) []string {
+				a.Log("from predictor")
+				return nil
+			}),
+		},
+	}
+
+	t.Run("match", func(t *testing.T) {
+		cmp := New2(NopParser(c), Match(MatchPrefixFold))
+		got := runComplete(cmp, "cmd st", -1)
+		sort.Strings(got)
+		if want := []string{"Status", "start", "stop"}; !equalSlices(got, want) {
+			t.Errorf("got = %s, want: %s", got, want)
+		}
+	})
+
+	t.Run("max suggestions", func(t *testing.T) {
+		cmp := New2(NopParser(c), MaxSuggestions(2))
+		got := runComplete(cmp, "cmd ", -1)
+		if want := []string{"Status", "start"}; !equalSlices(got, want) {
+			t.Errorf("got = %s, want: %s", got, want)
+		}
+	})
+
+	t.Run("timeout", func(t *testing.T) {
+		cmp := New2(NopParser(c), Timeout(10*time.Millisecond))
+		if got := runComplete(cmp, "cmd -slow ", -1); len(got) != 0 {
+			t.Errorf("got = %s, want: []", got)
+		}
+	})
+
+	t.Run("logger", func(t *testing.T) {
+		var logs []string
+		cmp := New2(NopParser(c), Logger(func(format string, args ...any) {
+			logs = append(logs, fmt.Sprintf(format, args...))
+		}))
+		runComplete(cmp, "cmd -log ", -1)
+		if !slices.Contains(logs, "from predictor") {
+			t.Errorf("predictor log not captured: %q", logs)
+		}
+	})
+
+	t.Run("env prefix", func(t *testing.T) {
+		cmp := New2(NopParser(c), EnvPrefix("MYCLI_"), DisableInstall())
+		if got := cmp.env("INSTALL"); got != "MYCLI_INSTALL" {
+			t.Errorf("got = %s, want: MYCLI_INSTALL", got)
+		}
+
+		// Installing is disabled, so we should fall through to completing
+		t.Setenv("MYCLI_INSTALL", "1")
+		got := runComplete(cmp, "cmd sto", -1)
+		if want := []string{"stop"}; !equalSlices(got, want) {
+			t.Errorf("got = %s, want: %s", got, want)
+		}
+	})
+}
+
+func TestMatchPrefixFold(t *testing.T) {
+	tests := []struct {
+		suggestion, typed string
+		want              bool
+	}{
+		{"Status", "st", true},
+		{"Status", "", true},
+		{"st", "Status", false},
+		{"stop", "sa", false},
+		// Folding changes the length in bytes
+		{"\u212Aelvin", "ke", true},
+		{"kelvin", "\u212A", true},
+		{"\u017Ftart", "ST", true},
+		{"\u017F", "sx", false},
+	}
+	for _, tt := range tests {
+		if got := MatchPrefixFold(tt.suggestion, tt.typed); got != tt.want {
+			t.Errorf("MatchPrefixFold(%q, %q) = %t, want %t", tt.suggestion, tt.typed, got, tt.want)
+		}
+	}
+}
+
+func TestCompleter_Complete_Middleware(t *testing.T) {
+	internal.Chdir(t)
+
+	var last string
+	record := func(inv Invocation, a Args, next Predictor) []string {
+		last = fmt.Sprintf("%s:%s", strings.Join(inv.Path, "/"), inv.Flag)
+		return next.Predict(a)
+	}
+	hideInternal := func(inv Invocation, a Args, next Predictor) []string {
+		return slices.DeleteFunc(next.Predict(a), func(s string) bool {
+			return strings.HasPrefix(strings.ToLower(s), "internal-")
+		})
+	}
+	upper := func(inv Invocation, a Args, next Predictor) []string {
+		var options []string
+		for _, o := range next.Predict(a) {
+			options = append(options, strings.ToUpper(o))
+		}
+		return options
+	}
+
+	c := Command{
+		Sub: Commands{
+			"deploy": {
+				Flags: Flags{
+					"-svc": PredictSet("api", "internal-db"),
+				},
+				Args:       PredictSet("now", "later"),
+				Middleware: []Middleware{upper},
+			},
+		},
+		GlobalFlags: Flags{
+			"-env": PredictSet("prod", "internal-test"),
+		},
+	}
+	cmp := New2(NopParser(c), Use(record, hideInternal))
+
+	tests := []struct {
+		line string
+		want []string
+		call string
+	}{
+		{
+			line: "cmd -env ",
+			want: []string{"prod"},
+			call: ":-env",
+		},
+		{
+			line: "cmd deploy -svc ",
+			want: []string{"API"},
+			call: "deploy:-svc",
+		},
+		{
+			line: "cmd deploy ",
+			want: []string{"NOW", "LATER"},
+			call: "deploy:",
+		},
+		{
+			// Owned by the root, but the user is under 'deploy'
+			line: "cmd deploy -env ",
+			want: []string{"prod"},
+			call: "deploy:-env",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.line, func(t *testing.T) {
+			got := runComplete(cmp, tt.line, -1)
+
+			sort.Strings(tt.want)
+			sort.Strings(got)
+
+			if !equalSlices(got, tt.want) {
+				t.Errorf("failed '%s'\ngot = %s\nwant: %s", t.Name(), got, tt.want)
+			}
+			if last != tt.call {
+				t.Errorf("failed '%s'\ncall = %s\nwant: %s", t.Name(), last, tt.call)
+			}
+		})
+	}
+}
+
+func TestCompleter_Complete_Context(t *testing.T) {
+	internal.Chdir(t)
+
+	// Describe the context as a suggestion, prefixed with what's typed so it isn't
+	// filtered out
+	describe := PredictFunc(func(a Args) []string {
+		var values []string
+		for _, flag := range slices.Sorted(maps.Keys(a.FlagValues)) {
+			values = append(values, flag+"="+strings.Join(a.FlagValues[flag], ","))
+		}
+		return []string{fmt.Sprintf(
+			"%spath=%s flag=%s pos=%d values=%s",
+			a.Last, strings.Join(a.Path, "/"), a.Flag, a.Position, strings.Join(values, ";"),
+		)}
+	})
+
+	c := Command{
+		Sub: Commands{
+			"svc": {
+				Sub: Commands{
+					"logs": {
+						Flags: Flags{
+							"-f":     PredictNothing,
+							"-since": describe,
+						},
+						Args: describe,
+					},
+				},
+			},
+		},
+		GlobalFlags: Flags{
+			"-env": describe,
+		},
+	}
+	cmp := New("cmd", c)
+
+	tests := []struct {
+		line string
+		want string
+	}{
+		{
+			line: "cmd -env ",
+			want: "path= flag=-env pos=0 values=",
+		},
+		{
+			line: "cmd -env prod svc logs ",
+			want: "path=svc/logs flag= pos=0 values=-env=prod",
+		},
+		{
+			line: "cmd svc logs -f api -since ",
+			want: "path=svc/logs flag=-since pos=1 values=-f=true",
+		},
+		{
+			line: "cmd svc logs -since=1h -env dev api web -env ",
+			want: "path=svc/logs flag=-env pos=2 values=-env=dev;-since=1h",
+		},
+		{
+			line: "cmd svc logs -- -f x",
+			want: "xpath=svc/logs flag= pos=1 values=",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.line, func(t *testing.T) {
+			got := runComplete(cmp, tt.line, -1)
+			if !equalSlices(got, []string{tt.want}) {
+				t.Errorf("failed '%s'\ngot = %s\nwant: %s", t.Name(), got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCompleter_Complete_SchemaParser(t *testing.T) {
+	internal.Chdir(t)
+
+	// Describe what was parsed as a suggestion, prefixed with what's typed
+	describe := PredictFunc(func(a Args) []string {
+		parsed, ok := a.Root().(*command.Parsed)
+		if !ok {
+			return nil
+		}
+		return []string{fmt.Sprintf(
+			"%senv=%s tags=%s verbose=%t args=%s",
+			a.Last, parsed.String("env"), strings.Join(parsed.Strings("--tag"), ","),
+			parsed.Bool("v"), strings.Join(parsed.Args, ","),
+		)}
+	})
+
+	c := Command{
+		Sub: Commands{
+			"deploy": {
+				Flags: Flags{
+					"--tag": PredictAnything,
+					"-v":    PredictNothing,
+				},
+				Args: describe,
+			},
+		},
+		GlobalFlags: Flags{
+			"--env": PredictAnything,
+		},
+	}
+	cmp := New2(SchemaParser(c))
+
+	tests := []struct {
+		line string
+		want string
+	}{
+		{
+			line: "cmd deploy ",
+			want: "env= tags= verbose=false args=",
+		},
+		{
+			line: "cmd --env prod deploy -v api ",
+			want: "env=prod tags= verbose=true args=api",
+		},
+		{
+			line: "cmd deploy --tag a --tag=b --env dev web --env prod ",
+			want: "env=prod tags=a,b verbose=false args=web",
+		},
+		{
+			line: "cmd deploy -v=false -- -v ",
+			want: "env= tags= verbose=false args=-v",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.line, func(t *testing.T) {
+			got := runComplete(cmp, tt.line, -1)
+			if !equalSlices(got, []string{tt.want}) {
+				t.Errorf("failed '%s'\ngot = %s\nwant: %s", t.Name(), got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCompleter_Complete_Values(t *testing.T) {
+	internal.Chdir(t)
+
+	type key string
+	show := PredictFunc(func(a Args) []string {
+		return []string{fmt.Sprintf("%s%v/%v", a.Last, a.Value(key("region")), a.Value(key("token")))}
+	})
+
+	c := Command{
+		Sub: Commands{
+			"eu": {
+				Args:   show,
+				Values: map[any]any{key("region"): "eu-west"},
+			},
+		},
+		GlobalFlags: Flags{
+			"-x": show,
+		},
+		Args:   show,
+		Values: map[any]any{key("region"): "us-east"},
+	}
+	cmp := New2(NopParser(c), Value(key("token"), "secret"), Value(key("region"), "ignored"))
+
+	tests := []struct {
+		line string
+		want []string
+	}{
+		{line: "cmd ", want: []string{"eu", "us-east/secret"}},
+		{line: "cmd eu ", want: []string{"eu-west/secret"}},
+		// Global flags are predicted by the command that owns them
+		{line: "cmd eu -x ", want: []string{"us-east/secret"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.line, func(t *testing.T) {
+			got := runComplete(cmp, tt.line, -1)
+			if !equalSlices(got, tt.want) {
+				t.Errorf("failed '%s'\ngot = %s\nwant: %s", t.Name(), got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSuggest(t *testing.T) {
+	internal.Chdir(t)
+
+	cp := NopParser(Command{
+		Sub: Commands{
+			"sub1": {},
+			"sub2": {},
+		},
+		Flags: Flags{
+			"-o": PredictSet("json", "yaml"),
+			"--tag": PredictFunc(func(a Args) []string {
+				a.SetDirective(args.DirectiveNoSpace)
+				return []string{"env:"}
+			}),
+		},
+	})
+
+	tests := []struct {
+		line  string
+		point int
+		want  Result
+	}{
+		{
+			line:  "cmd --tag ",
+			point: -1,
+			want:  Result{Suggestions: []string{"env:"}, Start: 10, End: 10, Directive: args.DirectiveNoSpace},
+		},
+		{
+			line:  "cmd ",
+			point: -1,
+			want:  Result{Suggestions: []string{"sub1", "sub2"}, Start: 4, End: 4},
+		},
+		{
+			line:  "cmd su",
+			point: -1,
+			want:  Result{Suggestions: []string{"sub1", "sub2"}, Start: 4, End: 6},
+		},
+		{
+			line:  "cmd -o y",
+			point: 7,
+			want:  Result{Suggestions: []string{"json", "yaml"}, Start: 7, End: 7},
+		},
+		{
+			line:  "cmd -o=j",
+			point: 100,
+			want:  Result{Suggestions: []string{"json"}, Start: 7, End: 8},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.line, func(t *testing.T) {
+			got := Suggest(cp, tt.line, tt.point)
+			sort.Strings(got.Suggestions)
+			if !equalSlices(got.Suggestions, tt.want.Suggestions) || got.Start != tt.want.Start || got.End != tt.want.End || got.Directive != tt.want.Directive {
+				t.Errorf("failed '%s'\ngot = %+v\nwant: %+v", t.Name(), got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCompleter_Complete_Lazy(t *testing.T) {
+	internal.Chdir(t)
+
+	built := 0
+	cp := Lazy(func() CommandParser {
+		built++
+		return NopParser(Command{Sub: Commands{"sub1": {}, "sub2": {}}})
+	})
+
+	// Nothing is built until completion is requested
+	c := New2(cp)
+	os.Unsetenv(envLine)
+	if c.Complete() {
+		t.Fatal("completion ran without a request")
+	}
+	if built != 0 {
+		t.Errorf("tree built %d times without a request", built)
+	}
+
+	got := runComplete(c, "cmd s", -1)
+	sort.Strings(got)
+	if !equalSlices(got, []string{"sub1", "sub2"}) || built != 1 {
+		t.Errorf("got %v, built %d times", got, built)
+	}
+}
+
+func TestIsRequest(t *testing.T) {
+	names := []string{envLine, envCommandLine, "COMP_INSTALL", "COMP_UNINSTALL", "COMP_GENERATE", "COMP_SERVE", "MY_INSTALL"}
+	for _, name := range names {
+		t.Setenv(name, "")
+	}
+	if IsRequest() {
+		t.Error("request detected without one")
+	}
+
+	for _, name := range names[:len(names)-1] {
+		t.Setenv(name, "1")
+		if !IsRequest() {
+			t.Errorf("%s not detected", name)
+		}
+		t.Setenv(name, "")
+	}
+
+	t.Setenv("MY_INSTALL", "1")
+	if IsRequest() {
+		t.Error("MY_INSTALL detected without EnvPrefix")
+	}
+	if !IsRequest(EnvPrefix("MY_")) {
+		t.Error("MY_INSTALL not detected with EnvPrefix")
+	}
+}
+
+func TestNew2F_Command(t *testing.T) {
+	tree := Command{Sub: Commands{"sub": {}}}
+	if c := New2F(io.Discard, NopParser(tree)); len(c.Command.Sub) != 1 {
+		t.Errorf("Command not set from the parser: %+v", c.Command)
+	}
+
+	built := false
+	c := New2F(io.Discard, Lazy(func() CommandParser {
+		built = true
+		return NopParser(tree)
+	}))
+	if built || len(c.Command.Sub) != 0 {
+		t.Error("lazy parser built before completing")
+	}
+}
+
+// BenchmarkComplete measures the cost of each TAB once the program is running,
+// from building a large tree through writing suggestions
+func BenchmarkComplete(b *testing.B) {
+	newParser := func() CommandParser {
+		sub := Commands{}
+		for i := range 500 {
+			flags := Flags{}
+			for j := range 20 {
+				flags[fmt.Sprintf("--flag%d", j)] = PredictAnything
+			}
+			sub[fmt.Sprintf("sub%d", i)] = Command{Flags: flags, Args: PredictSet("a", "b")}
+		}
+		return NopParser(Command{Sub: sub})
+	}
+
+	b.Setenv(envPoint, "")
+	for _, line := range []string{"cmd sub1", "cmd sub1 --flag1", "cmd sub1 --flag1 x "} {
+		b.Run(line, func(b *testing.B) {
+			for range b.N {
+				b.Setenv(envLine, line)
+				c := New2F(io.Discard, Lazy(newParser))
+				c.Aliases = []string{"cmd"}
+				c.Complete()
+			}
+		})
+	}
+
+	b.Run("not requested", func(b *testing.B) {
+		for range b.N {
+			os.Unsetenv(envLine)
+			if IsRequest() {
+				New2F(io.Discard, Lazy(newParser)).Complete()
+			}
+		}
+	})
+}
+
 // runComplete runs the complete login for test purposes
 // it gets the complete struct and command line arguments and returns
 // the complete options
@@ -386,6 +1321,7 @@ func runComplete(c *Complete, line string, point int) (completions []string) {
 	os.Setenv(envPoint, strconv.Itoa(point))
 	b := bytes.NewBuffer(nil)
 	c.Out = b
+	c.Aliases = []string{"cmd"}
 	c.Complete()
 	completions = parseOutput(b.String())
 	return
@@ -413,3 +1349,33 @@ func equalSlices(a, b []string) bool {
 	}
 	return true
 }
+
+func TestCheckProtocol(t *testing.T) {
+	tests := []struct {
+		shell    string
+		protocol int
+		want     string
+	}{
+		{shell: "bash", protocol: 1, want: "outdated (protocol 1, current 2), reinstall with COMP_UNINSTALL=1 and then COMP_INSTALL=1"},
+		{shell: "bash", protocol: 2},
+		// Only bash changed in protocol 2
+		{shell: "zsh", protocol: 1},
+		{shell: "fish", protocol: 2},
+		{shell: "zsh", protocol: 99, want: "newer"},
+	}
+	for _, tt := range tests {
+		t.Run(fmt.Sprintf("%s/%d", tt.shell, tt.protocol), func(t *testing.T) {
+			var logs []string
+			c := New2F(io.Discard, NopParser(Command{}))
+			c.logf = func(format string, args ...any) {
+				logs = append(logs, fmt.Sprintf(format, args...))
+			}
+			c.checkProtocol(request{shell: tt.shell, protocol: tt.protocol})
+
+			got := strings.Join(logs, "\n")
+			if tt.want == "" && got != "" || !strings.Contains(got, tt.want) {
+				t.Errorf("want a log containing %q, got %q", tt.want, got)
+			}
+		})
+	}
+}
@@ -37,6 +37,10 @@ type (
 	Commands = command.Commands
 	// Alias to [command.Flags] for import ergonomics
 	Flags = command.Flags
+	// Alias to [command.Middleware] for import ergonomics
+	Middleware = command.Middleware
+	// Alias to [command.Invocation] for import ergonomics
+	Invocation = command.Invocation
 )
 
 // Compatibility with posener/complete v1
@@ -11,7 +11,7 @@ import (
 	"github.com/coxley/complete"
 	"github.com/coxley/complete/args"
 	"github.com/coxley/complete/cmpcobra"
-	"github.com/coxley/complete/cmplog"
+	"github.com/coxley/complete/command"
 	"github.com/coxley/complete/predict"
 )
 
@@ -81,9 +81,10 @@ func run(cmd *cobra.Command, args []string) error {
 // predictFields returns the available fields for a given service if it's been
 // specified on the command-line
 func predictFields(args args.Args) []string {
-	root, ok := args.ParsedRoot.(*cobra.Command)
+	root, ok := args.Root().(*cobra.Command)
 	if !ok {
-		cmplog.Log("root cobra command not parsed")
+		args.Log("root cobra command not parsed")
+		return nil
 	}
 
 	posArgs := root.Flags().Args()
@@ -95,3 +96,31 @@ func predictFields(args args.Args) []string {
 	validFields := services[posArgs[0]]
 	return slices.Collect(maps.Keys(validFields))
 }
+
+// Same as Example_cobraDynamic, but without a CLI framework. The tree itself is used
+// to parse what's been typed so far.
+func Example_schemaDynamic() {
+	cmd := complete.Command{
+		Flags: complete.Flags{
+			"-f":      predict.Func(predictSchemaFields),
+			"--field": predict.Func(predictSchemaFields),
+		},
+		Args: predict.Set(slices.Collect(maps.Keys(services))...),
+	}
+
+	if complete.New2(complete.SchemaParser(cmd)).Complete() {
+		return
+	}
+}
+
+// predictSchemaFields returns the available fields for the service given as the
+// first positional argument
+func predictSchemaFields(args args.Args) []string {
+	parsed, ok := args.Root().(*command.Parsed)
+	if !ok || len(parsed.Args) == 0 {
+		return nil
+	}
+
+	validFields := services[parsed.Args[0]]
+	return slices.Collect(maps.Keys(validFields))
+}
@@ -65,7 +65,7 @@ func SubChildCommand() *cobra.Command {
 // predictNextValue returns the next value in the sequence by looking at '--num' values
 // set in other commands
 func predictNextValue(args args.Args) []string {
-	root := args.ParsedRoot.(*cobra.Command)
+	root := args.Root().(*cobra.Command)
 
 	rootNum := flagInt(root, "num")
 	childNum := flagInt(root.Commands()[0], "num")
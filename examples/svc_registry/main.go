@@ -11,11 +11,16 @@ import (
 	"github.com/coxley/complete"
 	"github.com/coxley/complete/args"
 	"github.com/coxley/complete/cmpcobra"
-	"github.com/coxley/complete/cmplog"
 	"github.com/coxley/complete/predict"
 )
 
-var services = map[string]map[string]string{
+// Registry maps each service to its metadata
+type Registry map[string]map[string]string
+
+// registryKey attaches the [Registry] to predictors
+type registryKey struct{}
+
+var services = Registry{
 	"server1": {
 		"grpc_addr": "some.host:50051",
 	},
@@ -33,12 +38,13 @@ var services = map[string]map[string]string{
 }
 
 func main() {
-	cmd := Command()
+	cmd := Command(services)
 	// We're not using the cobra completions so don't suggest it in help output
 	cmd.CompletionOptions.DisableDefaultCmd = true
 
-	// If tab-completion takes place, exit
-	if complete.New2(cmpcobra.New(cmd)).Complete() {
+	// If tab-completion takes place, exit. Predictors are handed the registry rather
+	// than reaching for a global, so tests can give them their own.
+	if complete.New2(cmpcobra.New(cmd), WithRegistry(services)).Complete() {
 		return
 	}
 
@@ -49,15 +55,19 @@ func main() {
 	}
 }
 
-func Command() *cobra.Command {
+// WithRegistry makes 'reg' available to predictors
+func WithRegistry(reg Registry) complete.Option {
+	return complete.Value(registryKey{}, reg)
+}
+
+func Command(reg Registry) *cobra.Command {
 	cmd := &cobra.Command{
-		Use:       "svc_registry",
-		Args:      cobra.ExactArgs(1),
-		ValidArgs: slices.Collect(maps.Keys(services)),
+		Use:  "svc_registry",
+		Args: cobra.ExactArgs(1),
 		RunE: func(cmd *cobra.Command, args []string) error {
 			// Print each requested field from the service registry
 			svc := args[0]
-			fields := services[svc]
+			fields := reg[svc]
 			wanted, err := cmd.Flags().GetStringArray("field")
 			if err != nil {
 				return err
@@ -72,15 +82,23 @@ func Command() *cobra.Command {
 
 	cmd.Flags().StringArrayP("field", "f", nil, "service fields to print")
 	cmpcobra.RegisterFlag(cmd, "field", predict.Func(predictFields))
+	cmpcobra.RegisterCmd(cmd, predict.Func(predictServices))
 	return cmd
 }
 
+// predictServices returns every service in the registry
+func predictServices(args args.Args) []string {
+	reg, _ := args.Value(registryKey{}).(Registry)
+	return slices.Collect(maps.Keys(reg))
+}
+
 // predictFields returns the available fields for a given service if it's been
 // specified on the command-line
 func predictFields(args args.Args) []string {
-	root, ok := args.ParsedRoot.(*cobra.Command)
+	root, ok := args.Root().(*cobra.Command)
 	if !ok {
-		cmplog.Log("root cobra command not parsed")
+		args.Log("root cobra command not parsed")
+		return nil
 	}
 
 	posArgs := root.Flags().Args()
@@ -89,6 +107,7 @@ func predictFields(args args.Args) []string {
 		return nil
 	}
 
-	validFields := services[posArgs[0]]
+	reg, _ := args.Value(registryKey{}).(Registry)
+	validFields := reg[posArgs[0]]
 	return slices.Collect(maps.Keys(validFields))
 }
@@ -10,6 +10,13 @@ import (
 )
 
 func TestRegistry(t *testing.T) {
+	reg := Registry{
+		"server1":   {"grpc_addr": "localhost:50051"},
+		"server2":   {"grpc_addr": "localhost:50052"},
+		"consumer1": {"pubsub_topic": "a", "pubsub_subscription": "a/b"},
+		"consumer2": {"pubsub_topic": "c", "pubsub_subscription": "c/d"},
+	}
+
 	tests := []struct {
 		name   string
 		prompt string
@@ -18,7 +25,7 @@ func TestRegistry(t *testing.T) {
 		{
 			name:   "services",
 			prompt: "svc_registry <TAB>",
-			want:   slices.Collect(maps.Keys(services)),
+			want:   slices.Collect(maps.Keys(reg)),
 		},
 		{
 			name:   "server1",
@@ -48,8 +55,8 @@ func TestRegistry(t *testing.T) {
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			completer := cmpcobra.New(Command())
-			cmptest.Assert(t, completer, tt.prompt, tt.want)
+			completer := cmpcobra.New(Command(reg))
+			cmptest.Assert(t, completer, tt.prompt, tt.want, WithRegistry(reg))
 		})
 	}
 }
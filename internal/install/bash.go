@@ -1,37 +1,153 @@
 package install
 
-import "fmt"
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"text/template"
+)
 
 // (un)install in bash
-// basically adds/remove from .bashrc:
+//
+// A completion function is written to the bash-completion user directory, which it
+// loads on demand. The file is also sourced from .bashrc so it works without it:
+//
+// [ -f <file> ] && source <file>
+//
+// With 'legacy' set, only a single line is added to .bashrc instead:
 //
 // complete -C </path/to/completion/command> <command>
 type bash struct {
-	rc string
+	rc     string
+	legacy bool
 }
 
 func (b bash) IsInstalled(cmd, bin string) bool {
-	completeCmd := b.cmd(cmd, bin)
-	return lineInFile(b.rc, completeCmd)
+	if b.legacy {
+		return lineInFile(b.rc, b.legacyCmd(cmd, bin))
+	}
+	if _, err := os.Stat(b.getCompletionFilePath(cmd)); err != nil {
+		return false
+	}
+	return lineInFile(b.rc, b.sourceCmd(cmd))
 }
 
 func (b bash) Install(cmd, bin string) error {
 	if b.IsInstalled(cmd, bin) {
 		return fmt.Errorf("already installed in %s", b.rc)
 	}
-	completeCmd := b.cmd(cmd, bin)
-	return appendFile(b.rc, completeCmd)
+	if b.legacy {
+		return appendFile(b.rc, b.legacyCmd(cmd, bin))
+	}
+
+	// Replace completion installed before the function existed
+	if legacy := b.legacyCmd(cmd, bin); lineInFile(b.rc, legacy) {
+		if err := removeFromFile(b.rc, legacy); err != nil {
+			return err
+		}
+	}
+
+	completionFile := b.getCompletionFilePath(cmd)
+	script, err := b.script(cmd, bin)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(completionFile), 0o755); err != nil {
+		return err
+	}
+	if err := createFile(completionFile, script); err != nil {
+		return err
+	}
+
+	if source := b.sourceCmd(cmd); !lineInFile(b.rc, source) {
+		return appendFile(b.rc, source)
+	}
+	return nil
 }
 
 func (b bash) Uninstall(cmd, bin string) error {
-	if !b.IsInstalled(cmd, bin) {
+	legacy := b.legacyCmd(cmd, bin)
+	hasLegacy := lineInFile(b.rc, legacy)
+	hasFunc := bash{rc: b.rc}.IsInstalled(cmd, bin)
+	if !hasLegacy && !hasFunc {
 		return fmt.Errorf("does not installed in %s", b.rc)
 	}
 
-	completeCmd := b.cmd(cmd, bin)
-	return removeFromFile(b.rc, completeCmd)
+	// Both may be present if the rc file was edited by hand
+	if hasLegacy {
+		if err := removeFromFile(b.rc, legacy); err != nil {
+			return err
+		}
+	}
+	if hasFunc {
+		return errors.Join(
+			removeFromFile(b.rc, b.sourceCmd(cmd)),
+			os.Remove(b.getCompletionFilePath(cmd)),
+		)
+	}
+	return nil
+}
+
+func (bash) getCompletionFilePath(cmd string) string {
+	return filepath.Join(getDataHomePath(), "bash-completion", "completions", filepath.Base(cmd))
 }
 
-func (bash) cmd(cmd, bin string) string {
+func (b bash) sourceCmd(cmd string) string {
+	file := b.getCompletionFilePath(cmd)
+	return fmt.Sprintf("[ -f %[1]s ] && source %[1]s", file)
+}
+
+// legacyCmd is how completion was installed before the completion function
+func (bash) legacyCmd(cmd, bin string) string {
 	return fmt.Sprintf("complete -C %s %s", bin, cmd)
 }
+
+// script defines a function that asks the program for suggestions, and applies the
+// directive it ends with. See args.Directive for what each bit means.
+func (bash) script(cmd, bin string) (string, error) {
+	var buf bytes.Buffer
+	params := struct {
+		Cmd, Func, Bin, Subcommand string
+		Protocol                   int
+	}{cmd, funcName(cmd), bin, Subcommand, CurrentProtocol("bash")}
+	tmpl := template.Must(template.New("script").Parse(`# bash completion for {{.Cmd}}
+_{{.Func}}_complete() {
+    local cur=${COMP_WORDS[COMP_CWORD]}
+    local line directive=0
+    local -a out=()
+    while IFS= read -r line; do
+        out+=("$line")
+    done < <(COMP_WORDBREAKS="$COMP_WORDBREAKS" COMP_TYPE="$COMP_TYPE" COLUMNS="$COLUMNS" {{.Bin}} {{.Subcommand}} --protocol {{.Protocol}} --shell bash -- "${COMP_LINE:0:COMP_POINT}" 2>/dev/null)
+
+    local n=${#out[@]}
+    if (( n > 0 )) && [[ ${out[n-1]} =~ ^:[0-9]+$ ]]; then
+        directive=${out[n-1]#:}
+        unset "out[n-1]"
+    fi
+
+    (( directive & 1 )) && compopt -o nospace 2>/dev/null
+    (( directive & 2 )) && compopt -o filenames 2>/dev/null
+    if (( ${#out[@]} == 0 )); then
+        if (( directive & 4 )); then
+            if declare -F _filedir >/dev/null; then
+                _filedir
+            else
+                compopt -o default 2>/dev/null
+            fi
+        fi
+        return
+    fi
+
+    # Descriptions are only written when listing, but never insert one
+    COMPREPLY=("${out[@]%%$'\t'*}")
+}
+complete -F _{{.Func}}_complete {{.Cmd}}
+`))
+	err := tmpl.Execute(&buf, params)
+	if err != nil {
+		return "", err
+	}
+	return buf.String(), nil
+}
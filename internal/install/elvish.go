@@ -0,0 +1,121 @@
+package install
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"text/template"
+)
+
+// (un)install in elvish
+//
+// A module defining the arg-completer is written to the lib directory, and loaded
+// from rc.elv:
+//
+// use <command>_completion
+type elvish struct {
+	configDir string
+}
+
+func (e elvish) IsInstalled(cmd, bin string) bool {
+	if _, err := os.Stat(e.getCompletionFilePath(cmd)); err != nil {
+		return false
+	}
+	return lineInFile(e.rc(), e.useCmd(cmd))
+}
+
+func (e elvish) Install(cmd, bin string) error {
+	if e.IsInstalled(cmd, bin) {
+		return fmt.Errorf("already installed in %s", e.rc())
+	}
+
+	completionFile := e.getCompletionFilePath(cmd)
+	script, err := e.script(cmd, bin)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(completionFile), 0o755); err != nil {
+		return err
+	}
+	if err := createFile(completionFile, script); err != nil {
+		return err
+	}
+
+	if use := e.useCmd(cmd); !lineInFile(e.rc(), use) {
+		return appendFile(e.rc(), use)
+	}
+	return nil
+}
+
+func (e elvish) Uninstall(cmd, bin string) error {
+	if !e.IsInstalled(cmd, bin) {
+		return fmt.Errorf("does not installed in %s", e.rc())
+	}
+	return errors.Join(
+		removeFromFile(e.rc(), e.useCmd(cmd)),
+		os.Remove(e.getCompletionFilePath(cmd)),
+	)
+}
+
+func (e elvish) rc() string {
+	return filepath.Join(e.configDir, "rc.elv")
+}
+
+func (elvish) module(cmd string) string {
+	return funcName(cmd) + "_completion"
+}
+
+func (e elvish) getCompletionFilePath(cmd string) string {
+	return filepath.Join(e.configDir, "lib", e.module(cmd)+".elv")
+}
+
+func (e elvish) useCmd(cmd string) string {
+	return "use " + e.module(cmd)
+}
+
+// script turns each suggestion into a complex candidate, showing its description.
+// See args.Directive for what each bit of the final ':N' line means.
+func (elvish) script(cmd, bin string) (string, error) {
+	var buf bytes.Buffer
+	params := struct {
+		Cmd, Bin, Subcommand string
+		Protocol             int
+	}{filepath.Base(cmd), bin, Subcommand, CurrentProtocol("elvish")}
+	tmpl := template.Must(template.New("script").Parse(`# elvish completion for {{.Cmd}}
+use str
+
+set edit:completion:arg-completer['{{.Cmd}}'] = {|@words|
+    var out = [((external '{{.Bin}}') {{.Subcommand}} --protocol {{.Protocol}} --shell elvish -- $@words 2>/dev/null)]
+    var directive = 0
+    if (and (> (count $out) 0) (str:has-prefix $out[-1] ':')) {
+        set directive = (num $out[-1][1..])
+        set out = $out[..-1]
+    }
+
+    if (and (== (count $out) 0) (>= (% $directive 8) 4)) {
+        edit:complete-filename $words[-1]
+        return
+    }
+
+    var suffix = ' '
+    if (== (% $directive 2) 1) {
+        set suffix = ''
+    }
+    for line $out {
+        var parts = [(str:split &max=2 "\t" $line)]
+        if (> (count $parts) 1) {
+            edit:complex-candidate $parts[0] &code-suffix=$suffix &display=$parts[0]' ('$parts[1]')'
+        } else {
+            edit:complex-candidate $parts[0] &code-suffix=$suffix
+        }
+    }
+}
+`))
+	err := tmpl.Execute(&buf, params)
+	if err != nil {
+		return "", err
+	}
+	return buf.String(), nil
+}
@@ -51,15 +51,17 @@ func (f fish) getCompletionFilePath(cmd string) string {
 
 func (f fish) cmd(cmd, bin string) (string, error) {
 	var buf bytes.Buffer
-	params := struct{ Cmd, Bin string }{cmd, bin}
+	params := struct {
+		Cmd, Func, Bin, Subcommand string
+		Protocol                   int
+	}{cmd, funcName(cmd), bin, Subcommand, CurrentProtocol("fish")}
 	tmpl := template.Must(template.New("cmd").Parse(`
-function __complete_{{.Cmd}}
-    set -lx COMP_LINE (commandline -cp)
-    test -z (commandline -ct)
-    and set COMP_LINE "$COMP_LINE "
-    {{.Bin}}
+function __complete_{{.Func}}
+    set -l tokens (commandline -opc)
+    set -l current (commandline -ct)
+    {{.Bin}} {{.Subcommand}} --protocol {{.Protocol}} --shell fish -- $tokens "$current"
 end
-complete -f -c {{.Cmd}} -a "(__complete_{{.Cmd}})"
+complete -f -c {{.Cmd}} -a "(__complete_{{.Func}})"
 `))
 	err := tmpl.Execute(&buf, params)
 	if err != nil {
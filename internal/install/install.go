@@ -12,13 +12,52 @@ import (
 	"strings"
 )
 
-func Run(name string, uninstall, yes bool, out io.Writer, in io.Reader) {
+const (
+	// Subcommand is the hidden argument installed scripts invoke the program with
+	Subcommand = "__complete"
+
+	// ProtocolVersion is the newest protocol the program speaks. Installed scripts
+	// give the program their shell's [CurrentProtocol], so it can tell when they're
+	// outdated.
+	//
+	// Bump whenever the arguments or output format change, and note which shells
+	// changed in shellProtocol.
+	//
+	//   - 1: '__complete' sub-command
+	//   - 2: bash reads descriptions after a tab, and a final ':N' directive line
+	ProtocolVersion = 2
+)
+
+// shellProtocol is the version each shell's script last changed in, for shells
+// that changed after the first
+var shellProtocol = map[string]int{
+	"bash": 2,
+}
+
+// CurrentProtocol returns the oldest version a script for 'shell' can speak without
+// being outdated, which is also the version written into new scripts. Bumping [ProtocolVersion] for one shell leaves the others current.
+func CurrentProtocol(shell string) int {
+	if v, ok := shellProtocol[shell]; ok {
+		return v
+	}
+	return 1
+}
+
+// Options customize how completion is installed
+type Options struct {
+	// LegacyBash installs 'complete -C' into bash, instead of a completion function
+	LegacyBash bool
+}
+
+// Run (un)installs completion for each of the names, prompting the user first unless
+// 'yes' is set
+func Run(names []string, uninstall, yes bool, opts Options, out io.Writer, in io.Reader) {
 	action := "install"
 	if uninstall {
 		action = "uninstall"
 	}
 	if !yes {
-		fmt.Fprintf(out, "%s completion for %s? ", action, name)
+		fmt.Fprintf(out, "%s completion for %s? ", action, strings.Join(names, ", "))
 		var answer string
 		if _, err := fmt.Fscanln(in, &answer); err != nil {
 			fmt.Fprintf(out, "error scanning: %v\n", err)
@@ -35,10 +74,14 @@ func Run(name string, uninstall, yes bool, out io.Writer, in io.Reader) {
 	fmt.Fprint(out, action+"ing...\n")
 
 	var err error
-	if uninstall {
-		err = Uninstall(name)
-	} else {
-		err = Install(name)
+	for _, name := range names {
+		var errN error
+		if uninstall {
+			errN = Uninstall(name, opts)
+		} else {
+			errN = Install(name, opts)
+		}
+		err = errors.Join(err, errN)
 	}
 	if err != nil {
 		fmt.Fprintf(out, "%s failed: %s\n", action, err)
@@ -54,12 +97,12 @@ type installer interface {
 
 // Install complete command given:
 // cmd: is the command name
-func Install(cmd string) error {
-	is := installers()
+func Install(cmd string, opts Options) error {
+	is := installers(opts)
 	if len(is) == 0 {
 		return errors.New("Did not find any shells to install")
 	}
-	bin, err := getBinaryPath()
+	bin, err := BinaryPath()
 	if err != nil {
 		return err
 	}
@@ -76,13 +119,13 @@ func Install(cmd string) error {
 
 // IsInstalled returns true if the completion
 // for the given cmd is installed.
-func IsInstalled(cmd string) bool {
-	bin, err := getBinaryPath()
+func IsInstalled(cmd string, opts Options) bool {
+	bin, err := BinaryPath()
 	if err != nil {
 		return false
 	}
 
-	for _, i := range installers() {
+	for _, i := range installers(opts) {
 		installed := i.IsInstalled(cmd, bin)
 		if installed {
 			return true
@@ -94,12 +137,12 @@ func IsInstalled(cmd string) bool {
 
 // Uninstall complete command given:
 // cmd: is the command name
-func Uninstall(cmd string) error {
-	is := installers()
+func Uninstall(cmd string, opts Options) error {
+	is := installers(opts)
 	if len(is) == 0 {
 		return errors.New("Did not find any shells to uninstall")
 	}
-	bin, err := getBinaryPath()
+	bin, err := BinaryPath()
 	if err != nil {
 		return err
 	}
@@ -114,7 +157,7 @@ func Uninstall(cmd string) error {
 	return err
 }
 
-func installers() (i []installer) {
+func installers(opts Options) (i []installer) {
 	// The list of bash config files candidates where it is
 	// possible to install the completion command.
 	var bashConfFiles []string
@@ -126,19 +169,58 @@ func installers() (i []installer) {
 	}
 	for _, rc := range bashConfFiles {
 		if f := rcFile(rc); f != "" {
-			i = append(i, bash{f})
+			i = append(i, bash{f, opts.LegacyBash})
 			break
 		}
 	}
 	if f := rcFile(".zshrc"); f != "" {
 		i = append(i, zsh{f})
 	}
+	for _, rc := range []string{".tcshrc", ".cshrc"} {
+		if f := rcFile(rc); f != "" {
+			i = append(i, tcsh{f})
+			break
+		}
+	}
 	if d := fishConfigDir(); d != "" {
 		i = append(i, fish{d})
 	}
+	if d := powershellConfigDir(); d != "" {
+		i = append(i, powershell{d})
+	}
+	if d := nushellConfigDir(); d != "" {
+		i = append(i, nushell{d})
+	}
+	if d := elvishConfigDir(); d != "" {
+		i = append(i, elvish{d})
+	}
 	return
 }
 
+func elvishConfigDir() string {
+	configDir := filepath.Join(getConfigHomePath(), "elvish")
+	if info, err := os.Stat(configDir); err != nil || !info.IsDir() {
+		return ""
+	}
+	return configDir
+}
+
+func nushellConfigDir() string {
+	configDir := filepath.Join(getConfigHomePath(), "nushell")
+	if info, err := os.Stat(configDir); err != nil || !info.IsDir() {
+		return ""
+	}
+	return configDir
+}
+
+func powershellConfigDir() string {
+	configDir := filepath.Join(getConfigHomePath(), "powershell")
+	if info, err := os.Stat(configDir); err != nil || !info.IsDir() {
+		return ""
+	}
+	return configDir
+}
+
 func fishConfigDir() string {
 	configDir := filepath.Join(getConfigHomePath(), "fish")
 	if configDir == "" {
@@ -150,6 +232,18 @@ func fishConfigDir() string {
 	return configDir
 }
 
+func getDataHomePath() string {
+	dataHome := os.Getenv("XDG_DATA_HOME")
+	if dataHome != "" {
+		return dataHome
+	}
+	u, err := user.Current()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(u.HomeDir, ".local", "share")
+}
+
 func getConfigHomePath() string {
 	u, err := user.Current()
 	if err != nil {
@@ -163,12 +257,12 @@ func getConfigHomePath() string {
 	return configHome
 }
 
+// BinaryPath resolves the executable path to use for completion, following the
+// symlink if relevant.
+//
 // When doing self-completion, we can't assume that argv[0] is always in the
 // user's path.
-//
-// Resolve the executable path to use for completion, following the symlink if
-// relevant.
-func getBinaryPath() (string, error) {
+func BinaryPath() (string, error) {
 	exePath, err := os.Executable()
 	if err != nil {
 		return "", fmt.Errorf("couldn't resolve exec pat: %w", err)
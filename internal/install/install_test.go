@@ -0,0 +1,271 @@
+package install
+
+import (
+	"cmp"
+	"flag"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/coxley/complete/args"
+	"github.com/coxley/complete/command"
+	"github.com/coxley/complete/predict"
+)
+
+var update = flag.Bool("update", false, "update golden files in testdata")
+
+// golden compares 'got' with testdata/<name>.golden, or updates it with -update
+func golden(t *testing.T, name, got string) {
+	t.Helper()
+	path := filepath.Join("testdata", name+".golden")
+	if *update {
+		require.NoError(t, os.MkdirAll("testdata", 0o755))
+		require.NoError(t, os.WriteFile(path, []byte(got), 0o644))
+	}
+
+	want, err := os.ReadFile(path)
+	require.NoError(t, err, "run 'go test -update' to create it")
+	require.Equal(t, string(want), got, "run 'go test -update' if the change is intended")
+}
+
+func TestInstallers(t *testing.T) {
+	const bin = "/opt/mycli/bin/mycli"
+	tests := []struct {
+		name string
+		new  func(dir string) installer
+		// files written by Install, relative to the directory. The first is compared
+		// with testdata/<golden>.golden, if set.
+		files  []string
+		golden string
+		// rc loads the completion, and should only have 'want' added to it
+		rc, want string
+		// mine is what the rc holds before installing, and after uninstalling
+		mine string
+	}{
+		{
+			name:   "bash",
+			new:    func(dir string) installer { return bash{rc: filepath.Join(dir, ".bashrc")} },
+			files:  []string{"bash-completion/completions/mycli"},
+			golden: "bash",
+			rc:     ".bashrc",
+			want:   "[ -f {dir}/bash-completion/completions/mycli ] && source {dir}/bash-completion/completions/mycli\n",
+		},
+		{
+			name: "bash legacy",
+			new:  func(dir string) installer { return bash{rc: filepath.Join(dir, ".bashrc"), legacy: true} },
+			rc:   ".bashrc",
+			want: "complete -C /opt/mycli/bin/mycli mycli\n",
+		},
+		{
+			name: "zsh",
+			new:  func(dir string) installer { return zsh{filepath.Join(dir, ".zshrc")} },
+			rc:   ".zshrc",
+			want: zsh{}.cmd("mycli", bin) + "\n",
+			// compinit is left for anything else that needs it
+			mine: "# mine\n" + zshCompInit + "\n",
+		},
+		{
+			name:   "powershell",
+			new:    func(dir string) installer { return powershell{configDir: dir} },
+			files:  []string{"completions/mycli.ps1"},
+			golden: "powershell",
+			rc:     "profile.ps1",
+			want:   ". '{dir}/completions/mycli.ps1'\n",
+		},
+		{
+			name:   "nushell",
+			new:    func(dir string) installer { return nushell{configDir: dir} },
+			files:  []string{"autoload/mycli-completion.nu"},
+			golden: "nushell",
+		},
+		{
+			name:   "elvish",
+			new:    func(dir string) installer { return elvish{configDir: dir} },
+			files:  []string{"lib/mycli_completion.elv"},
+			golden: "elvish",
+			rc:     "rc.elv",
+			want:   "use mycli_completion\n",
+		},
+		{
+			name: "tcsh",
+			new:  func(dir string) installer { return tcsh{filepath.Join(dir, ".tcshrc")} },
+			rc:   ".tcshrc",
+			want: "if ($?tcsh) complete mycli 'p@*@`/opt/mycli/bin/mycli`@'\n",
+		},
+		{
+			name:  "fish",
+			new:   func(dir string) installer { return fish{configDir: dir} },
+			files: []string{"completions/mycli.fish"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			t.Setenv("XDG_DATA_HOME", dir)
+			mine := cmp.Or(tt.mine, "# mine\n")
+			rc := filepath.Join(dir, tt.rc)
+			if tt.rc != "" {
+				require.NoError(t, os.WriteFile(rc, []byte(mine), 0o644))
+			}
+
+			i := tt.new(dir)
+			require.False(t, i.IsInstalled("mycli", bin))
+			require.NoError(t, i.Install("mycli", bin))
+			require.True(t, i.IsInstalled("mycli", bin))
+			require.Error(t, i.Install("mycli", bin))
+
+			for _, f := range tt.files {
+				require.FileExists(t, filepath.Join(dir, f))
+			}
+			if tt.golden != "" {
+				script, err := os.ReadFile(filepath.Join(dir, tt.files[0]))
+				require.NoError(t, err)
+				// createFile ends the script with another newline
+				golden(t, tt.golden, strings.TrimSuffix(string(script), "\n"))
+			}
+			if tt.rc != "" {
+				got, err := os.ReadFile(rc)
+				require.NoError(t, err)
+				require.Equal(t, mine+strings.ReplaceAll(tt.want, "{dir}", dir), string(got))
+			}
+
+			require.NoError(t, i.Uninstall("mycli", bin))
+			require.False(t, i.IsInstalled("mycli", bin))
+			require.Error(t, i.Uninstall("mycli", bin))
+			for _, f := range tt.files {
+				require.NoFileExists(t, filepath.Join(dir, f))
+			}
+			if tt.rc != "" {
+				got, err := os.ReadFile(rc)
+				require.NoError(t, err)
+				require.Equal(t, mine, string(got))
+			}
+		})
+	}
+}
+
+func TestPowershell_Quote(t *testing.T) {
+	got, err := powershell{}.script("mycli", "/opt/it's/mycli")
+	require.NoError(t, err)
+	require.Contains(t, got, "& '/opt/it''s/mycli' __complete")
+
+	p := powershell{configDir: "/home/o'brien/.config/powershell"}
+	require.Equal(t, ". '/home/o''brien/.config/powershell/completions/mycli.ps1'", p.sourceCmd("mycli"))
+}
+
+func TestStatic(t *testing.T) {
+	tree := command.Command{
+		GlobalFlags: command.Flags{
+			"--env": predict.Set("prod\tProduction", "staging"),
+			"-v":    nil,
+		},
+		Sub: command.Commands{
+			"build": {
+				Flags: command.Flags{
+					"--out": predict.Dirs("*"),
+					"--tag": predict.Func(func(args.Args) []string { return nil }),
+				},
+				Args: predict.Files("*.go"),
+			},
+			"deploy": {
+				Sub: command.Commands{
+					"rollback": {Args: predict.Set("it's")},
+				},
+			},
+			"exec": {Delegate: predict.Anything},
+		},
+	}
+
+	for _, shell := range []string{"bash", "zsh", "fish"} {
+		t.Run(shell, func(t *testing.T) {
+			got, err := Static(shell, "mycli", "/opt/mycli/bin/mycli", tree)
+			require.NoError(t, err)
+			golden(t, "static_"+shell, got)
+		})
+	}
+
+	_, err := Static("tcsh", "mycli", "", tree)
+	require.Error(t, err)
+}
+
+func TestTcsh_Unguarded(t *testing.T) {
+	rc := filepath.Join(t.TempDir(), ".cshrc")
+	c := tcsh{rc}
+	unguarded := c.unguardedCmd("mycli", "/bin/mycli") + "\n"
+	require.NoError(t, os.WriteFile(rc, []byte(unguarded), 0o644))
+
+	// Installing again guards the line for plain csh
+	require.NoError(t, c.Install("mycli", "/bin/mycli"))
+	got, err := os.ReadFile(rc)
+	require.NoError(t, err)
+	require.Equal(t, c.cmd("mycli", "/bin/mycli")+"\n", string(got))
+
+	require.NoError(t, os.WriteFile(rc, []byte(unguarded), 0o644))
+	require.NoError(t, c.Uninstall("mycli", "/bin/mycli"))
+	got, err = os.ReadFile(rc)
+	require.NoError(t, err)
+	require.Empty(t, string(got))
+}
+
+func TestZsh_Uninstall(t *testing.T) {
+	rc := filepath.Join(t.TempDir(), ".zshrc")
+	z := zsh{rc}
+	lines := zshCompInit + "\n" + z.legacyCmd("mycli", "/bin/mycli") + "\n" + z.cmd("mycli", "/bin/mycli") + "\n"
+	require.NoError(t, os.WriteFile(rc, []byte(lines), 0o644))
+
+	require.NoError(t, z.Uninstall("mycli", "/bin/mycli"))
+	got, err := os.ReadFile(rc)
+	require.NoError(t, err)
+	require.Equal(t, zshCompInit+"\n", string(got))
+	require.Error(t, z.Uninstall("mycli", "/bin/mycli"))
+}
+
+func TestZsh_Outdated(t *testing.T) {
+	rc := filepath.Join(t.TempDir(), ".zshrc")
+	z := zsh{rc}
+	// Written by an older build, at another path and protocol
+	old := strings.Replace(z.cmd("mycli", "/old/mycli"), "--protocol 1", "--protocol 0", 1)
+	require.NotEqual(t, z.cmd("mycli", "/old/mycli"), old)
+	require.NoError(t, os.WriteFile(rc, []byte("# mine\n"+old+"\n"), 0o644))
+
+	require.True(t, z.IsInstalled("mycli", "/bin/mycli"))
+	require.NoError(t, z.Uninstall("mycli", "/bin/mycli"))
+	got, err := os.ReadFile(rc)
+	require.NoError(t, err)
+	require.Equal(t, "# mine\n", string(got))
+
+	// Only the line for this command is matched
+	other := z.cmd("mycli2", "/bin/mycli2") + "\n"
+	require.NoError(t, os.WriteFile(rc, []byte(other), 0o644))
+	require.False(t, z.IsInstalled("mycli", "/bin/mycli"))
+}
+
+func TestBash_Legacy(t *testing.T) {
+	dir := t.TempDir()
+	t.Setenv("XDG_DATA_HOME", dir)
+	rc := filepath.Join(dir, ".bashrc")
+	b := bash{rc: rc}
+	legacy := b.legacyCmd("mycli", "/bin/mycli")
+	require.NoError(t, os.WriteFile(rc, []byte("# mine\n"+legacy+"\n"), 0o644))
+
+	// Installing the function replaces the 'complete -C' line
+	require.NoError(t, b.Install("mycli", "/bin/mycli"))
+	got, err := os.ReadFile(rc)
+	require.NoError(t, err)
+	require.Equal(t, "# mine\n"+b.sourceCmd("mycli")+"\n", string(got))
+
+	// Both are removed, whichever the installer was made for
+	for _, i := range []bash{b, {rc: rc, legacy: true}} {
+		require.NoError(t, appendFile(rc, legacy))
+		require.NoError(t, i.Uninstall("mycli", "/bin/mycli"))
+		got, err = os.ReadFile(rc)
+		require.NoError(t, err)
+		require.Equal(t, "# mine\n", string(got))
+		require.NoFileExists(t, b.getCompletionFilePath("mycli"))
+		require.NoError(t, b.Install("mycli", "/bin/mycli"))
+	}
+}
@@ -0,0 +1,77 @@
+package install
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"text/template"
+)
+
+// (un)install in nushell
+//
+// Nushell has a single external completer for every command, so the snippet wraps
+// whichever was configured before it. Only the completer is replaced, so settings
+// like 'enable' and 'max_results' are left to the user. It's written to the autoload
+// directory, which nushell sources on start-up.
+type nushell struct {
+	configDir string
+}
+
+func (n nushell) IsInstalled(cmd, bin string) bool {
+	_, err := os.Stat(n.getCompletionFilePath(cmd))
+	return err == nil
+}
+
+func (n nushell) Install(cmd, bin string) error {
+	if n.IsInstalled(cmd, bin) {
+		return fmt.Errorf("already installed at %s", n.getCompletionFilePath(cmd))
+	}
+
+	completionFile := n.getCompletionFilePath(cmd)
+	script, err := n.script(cmd, bin)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(completionFile), 0o755); err != nil {
+		return err
+	}
+	return createFile(completionFile, script)
+}
+
+func (n nushell) Uninstall(cmd, bin string) error {
+	if !n.IsInstalled(cmd, bin) {
+		return fmt.Errorf("does not installed in %s", n.configDir)
+	}
+	return os.Remove(n.getCompletionFilePath(cmd))
+}
+
+func (n nushell) getCompletionFilePath(cmd string) string {
+	return filepath.Join(n.configDir, "autoload", fmt.Sprintf("%s-completion.nu", filepath.Base(cmd)))
+}
+
+// script hands the spans of the command-line to the program, which replies with
+// JSON records of 'value' and 'description'
+func (nushell) script(cmd, bin string) (string, error) {
+	var buf bytes.Buffer
+	params := struct {
+		Cmd, Func, Bin, Subcommand string
+		Protocol                   int
+	}{filepath.Base(cmd), funcName(cmd), bin, Subcommand, CurrentProtocol("nu")}
+	tmpl := template.Must(template.New("script").Parse(`# nushell completion for {{.Cmd}}
+let __complete_{{.Func}}_previous = $env.config.completions.external.completer?
+
+$env.config.completions.external.completer = {|spans|
+    if ($spans | first) == '{{.Cmd}}' {
+        ^'{{.Bin}}' {{.Subcommand}} --protocol {{.Protocol}} --shell nu -- ...$spans | from json
+    } else if $__complete_{{.Func}}_previous != null {
+        do $__complete_{{.Func}}_previous $spans
+    }
+}
+`))
+	err := tmpl.Execute(&buf, params)
+	if err != nil {
+		return "", err
+	}
+	return buf.String(), nil
+}
@@ -0,0 +1,126 @@
+package install
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"text/template"
+)
+
+// (un)install in powershell
+//
+// A script registering an argument completer is written next to the profile, and
+// dot-sourced from it:
+//
+// . <file>
+type powershell struct {
+	configDir string
+}
+
+func (p powershell) IsInstalled(cmd, bin string) bool {
+	if _, err := os.Stat(p.getCompletionFilePath(cmd)); err != nil {
+		return false
+	}
+	return lineInFile(p.profile(), p.sourceCmd(cmd))
+}
+
+func (p powershell) Install(cmd, bin string) error {
+	if p.IsInstalled(cmd, bin) {
+		return fmt.Errorf("already installed in %s", p.profile())
+	}
+
+	completionFile := p.getCompletionFilePath(cmd)
+	script, err := p.script(cmd, bin)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(completionFile), 0o755); err != nil {
+		return err
+	}
+	if err := createFile(completionFile, script); err != nil {
+		return err
+	}
+
+	if source := p.sourceCmd(cmd); !lineInFile(p.profile(), source) {
+		return appendFile(p.profile(), source)
+	}
+	return nil
+}
+
+func (p powershell) Uninstall(cmd, bin string) error {
+	if !p.IsInstalled(cmd, bin) {
+		return fmt.Errorf("does not installed in %s", p.profile())
+	}
+	return errors.Join(
+		removeFromFile(p.profile(), p.sourceCmd(cmd)),
+		os.Remove(p.getCompletionFilePath(cmd)),
+	)
+}
+
+// profile is loaded by every PowerShell host for the current user
+func (p powershell) profile() string {
+	return filepath.Join(p.configDir, "profile.ps1")
+}
+
+func (p powershell) getCompletionFilePath(cmd string) string {
+	return filepath.Join(p.configDir, "completions", filepath.Base(cmd)+".ps1")
+}
+
+func (p powershell) sourceCmd(cmd string) string {
+	return ". " + psQuote(p.getCompletionFilePath(cmd))
+}
+
+// psQuote quotes 's' as a literal string, where only a single quote needs escaping
+func psQuote(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", "''") + "'"
+}
+
+// script registers a completer that asks the program for suggestions, turning each
+// into a CompletionResult. Descriptions follow a tab, and are shown as tooltips.
+func (powershell) script(cmd, bin string) (string, error) {
+	var buf bytes.Buffer
+	params := struct {
+		Cmd, Bin, Subcommand string
+		Protocol             int
+	}{filepath.Base(cmd), bin, Subcommand, CurrentProtocol("powershell")}
+	funcs := template.FuncMap{"quote": psQuote}
+	tmpl := template.Must(template.New("script").Funcs(funcs).Parse(`# powershell completion for {{.Cmd}}
+Register-ArgumentCompleter -Native -CommandName {{quote .Cmd}} -ScriptBlock {
+    param($wordToComplete, $commandAst, $cursorPosition)
+
+    # Trailing spaces aren't part of the command, but mean a new word was started
+    $line = $commandAst.Extent.Text
+    $point = $cursorPosition - $commandAst.Extent.StartOffset
+    if ($point -lt $line.Length) {
+        $line = $line.Substring(0, $point)
+    }
+    $line = $line.PadRight($point)
+
+    # The whole word is replaced, but suggestions for '--flag=' are only the value
+    $prefix = ''
+    if ($wordToComplete -match '^(-[^=]*=)') {
+        $prefix = $Matches[1]
+    }
+
+    & {{quote .Bin}} {{.Subcommand}} --protocol {{.Protocol}} --shell powershell -- $line 2>$null | ForEach-Object {
+        $value, $desc = $_ -split "` + "`" + `t", 2
+        if (-not $desc) {
+            $desc = $value
+        }
+        $text = $prefix + $value
+        if ($text -match '[\s''"]') {
+            $text = "'" + ($text -replace "'", "''") + "'"
+        }
+        [System.Management.Automation.CompletionResult]::new($text, $value, 'ParameterValue', $desc)
+    }
+}
+`))
+	err := tmpl.Execute(&buf, params)
+	if err != nil {
+		return "", err
+	}
+	return buf.String(), nil
+}
@@ -0,0 +1,411 @@
+package install
+
+import (
+	"bytes"
+	"fmt"
+	"maps"
+	"path/filepath"
+	"slices"
+	"strings"
+	"text/template"
+
+	"github.com/coxley/complete/command"
+	"github.com/coxley/complete/predict"
+)
+
+// Static returns a completion script for 'shell' with the command tree written into
+// it, so the program only runs for predictors that need it
+//
+// Sub-commands, flags, [predict.Set] values, and [predict.Files] or [predict.Dirs]
+// are completed by the shell alone. Anything else runs 'bin' with [Subcommand], or
+// 'cmd' from PATH if 'bin' is empty.
+func Static(shell, cmd, bin string, tree command.Command) (string, error) {
+	tmpl, ok := staticScripts[shell]
+	if !ok {
+		return "", fmt.Errorf("can't generate completion for %q, only bash, zsh, and fish", shell)
+	}
+
+	cmd = filepath.Base(cmd)
+	if bin == "" {
+		bin = cmd
+	}
+	params := struct {
+		Cmd, Func, Bin, Subcommand string
+		Protocol                   int
+		Nodes                      []staticNode
+	}{cmd, funcName(cmd), bin, Subcommand, CurrentProtocol(shell), staticNodes(tree)}
+
+	var buf bytes.Buffer
+	if err := tmpl.Execute(&buf, params); err != nil {
+		return "", err
+	}
+	return buf.String(), nil
+}
+
+// staticNode is a command in the tree, keyed by the sub-commands leading to it each
+// preceded by a space. The root is the empty key.
+type staticNode struct {
+	Key string
+	// Dynamic is set when predicting anything here needs the program, such as when
+	// it has a delegate or middleware
+	Dynamic bool
+	Subs    []string
+	Flags   []string
+	// Values are the flags that expect one, and how to complete it
+	Values []staticFlag
+	Args   staticComp
+}
+
+type staticFlag struct {
+	Name string
+	Comp staticComp
+}
+
+// staticComp describes how to complete a flag value or argument
+type staticComp struct {
+	Dynamic bool
+	Values  []string
+	Files   bool
+	Dirs    bool
+	Pattern string
+}
+
+// staticNodes flattens 'tree' into a node for each command, parents first
+func staticNodes(tree command.Command) []staticNode {
+	var nodes []staticNode
+	var walk func(key string, c command.Command, inherited command.Flags)
+	walk = func(key string, c command.Command, inherited command.Flags) {
+		n := staticNode{Key: key}
+		// Sub-commands aren't written out below a dynamic command, so the program is
+		// asked about them too
+		if c.Delegate != nil || c.DisableInterspersed || len(c.Middleware) > 0 {
+			n.Dynamic = true
+			nodes = append(nodes, n)
+			return
+		}
+
+		global := maps.Clone(inherited)
+		if global == nil {
+			global = command.Flags{}
+		}
+		maps.Copy(global, c.GlobalFlags)
+		flags := maps.Clone(global)
+		maps.Copy(flags, c.Flags)
+
+		n.Subs = slices.Sorted(maps.Keys(c.Sub))
+		n.Flags = slices.Sorted(maps.Keys(flags))
+		for _, name := range n.Flags {
+			if p := flags[name]; p != nil {
+				n.Values = append(n.Values, staticFlag{name, staticPredictor(p)})
+			}
+		}
+		if c.Args != nil {
+			n.Args = staticPredictor(c.Args)
+		}
+		nodes = append(nodes, n)
+
+		for _, name := range n.Subs {
+			walk(key+" "+name, c.Sub[name], global)
+		}
+	}
+	walk("", tree, nil)
+	return nodes
+}
+
+func staticPredictor(p predict.Predictor) staticComp {
+	if values, ok := predict.StaticValues(p); ok {
+		return staticComp{Values: values}
+	}
+	if pattern, dirs, ok := predict.FilePattern(p); ok {
+		return staticComp{Files: !dirs, Dirs: dirs, Pattern: pattern}
+	}
+	return staticComp{Dynamic: true}
+}
+
+var staticFuncs = template.FuncMap{
+	// sh quotes a word, or a list of them, for bash and zsh. Descriptions are dropped
+	// since they can't be shown.
+	"sh": func(words any) string {
+		return quoteWords(words, func(w string) string {
+			w, _, _ = strings.Cut(w, "\t")
+			return "'" + strings.ReplaceAll(w, "'", `'\''`) + "'"
+		})
+	},
+	// fish quotes a word, or a list of them, for fish. Backslashes are escaped in
+	// single quotes too.
+	"fish": func(words any) string {
+		return quoteWords(words, func(w string) string {
+			return "'" + strings.NewReplacer(`\`, `\\`, "'", `\'`).Replace(w) + "'"
+		})
+	},
+	// suffix returns the extension of patterns like '*.go', which fish can complete
+	// by itself
+	"suffix": func(pattern string) string {
+		ext, ok := strings.CutPrefix(pattern, "*")
+		if !ok || !strings.HasPrefix(ext, ".") || strings.ContainsAny(ext, `*?[\`) {
+			return ""
+		}
+		return ext
+	},
+	// keys of every node but the root, which the words typed are matched against
+	"keys": func(nodes []staticNode) (keys []string) {
+		for _, n := range nodes {
+			if n.Key != "" {
+				keys = append(keys, n.Key)
+			}
+		}
+		return
+	},
+	// valueKeys are each node's key followed by a flag that takes a value, so the
+	// value isn't mistaken for a sub-command
+	"valueKeys": func(nodes []staticNode) (keys []string) {
+		for _, n := range nodes {
+			for _, f := range n.Values {
+				keys = append(keys, n.Key+" "+f.Name)
+			}
+		}
+		return
+	},
+}
+
+// quoteWords quotes a string, or each of a []string joined by spaces
+func quoteWords(words any, quote func(string) string) string {
+	switch words := words.(type) {
+	case string:
+		return quote(words)
+	case []string:
+		quoted := make([]string, len(words))
+		for i, w := range words {
+			quoted[i] = quote(w)
+		}
+		return strings.Join(quoted, " ")
+	}
+	panic(fmt.Sprintf("can't quote %T", words))
+}
+
+// staticBase has what bash and zsh share, since the syntax is the same
+var staticBase = template.Must(template.New("static").Funcs(staticFuncs).Parse(`
+{{- define "shComp"}}
+{{- if .Dynamic}}dynamic=1
+{{- else if .Files}}files={{sh .Pattern}}
+{{- else if .Dirs}}dirs=1
+{{- else if .Values}}vals+=({{sh .Values}})
+{{- end}}
+{{- end}}
+
+{{- define "shNodes"}}
+{{- if or (keys .) (valueKeys .)}}
+        if [[ -n $skip ]]; then
+            skip=
+            continue
+        fi
+        case "$node $w" in
+{{- with valueKeys .}}
+        {{range $i, $k := .}}{{if $i}}|{{end}}{{sh $k}}{{end}}) skip=1 ;;
+{{- end}}
+{{- with keys .}}
+        {{range $i, $k := .}}{{if $i}}|{{end}}{{sh $k}}{{end}}) node="$node $w" ;;
+{{- end}}
+        esac
+{{- end}}
+{{- end}}
+
+{{- define "shCases"}}
+    case "$node" in
+{{- range .}}
+    {{sh .Key}})
+{{- if .Dynamic}}
+        dynamic=1
+{{- else}}
+        case "$prev" in
+{{- range .Values}}
+        {{sh .Name}}) {{template "shComp" .Comp}} ;;
+{{- end}}
+        *)
+            vals=({{sh .Subs}})
+            flags=({{sh .Flags}})
+{{- with .Args}}{{if or .Dynamic .Files .Dirs .Values}}
+            {{template "shComp" .}}
+{{- end}}{{end}}
+            ;;
+        esac
+{{- end}}
+        ;;
+{{- end}}
+    esac
+{{- end}}`))
+
+func staticScript(text string) *template.Template {
+	return template.Must(template.Must(staticBase.Clone()).Parse(text))
+}
+
+var staticScripts = map[string]*template.Template{
+	"bash": staticScript(`# bash completion for {{.Cmd}}, generated from its command tree
+_{{.Func}}_dynamic() {
+    local line directive=0
+    local -a out=()
+    while IFS= read -r line; do
+        out+=("$line")
+    done < <(COMP_WORDBREAKS="$COMP_WORDBREAKS" {{sh .Bin}} {{.Subcommand}} --protocol {{.Protocol}} --shell bash -- "${COMP_LINE:0:COMP_POINT}" 2>/dev/null)
+
+    local n=${#out[@]}
+    if (( n > 0 )) && [[ ${out[n-1]} =~ ^:[0-9]+$ ]]; then
+        directive=${out[n-1]#:}
+        unset "out[n-1]"
+    fi
+    (( directive & 1 )) && compopt -o nospace 2>/dev/null
+    (( directive & 2 )) && compopt -o filenames 2>/dev/null
+    (( directive & 4 && ${#out[@]} == 0 )) && compopt -o default 2>/dev/null
+    COMPREPLY=("${out[@]}")
+}
+
+_{{.Func}}_static() {
+    local cur=${COMP_WORDS[COMP_CWORD]} prev= node= skip= w i
+    (( COMP_CWORD > 1 )) && prev=${COMP_WORDS[COMP_CWORD-1]}
+    # bash splits '--flag=value' into three words
+    [[ $prev == = ]] && (( COMP_CWORD > 2 )) && prev=${COMP_WORDS[COMP_CWORD-2]}
+    for (( i = 1; i < COMP_CWORD; i++ )); do
+        w=${COMP_WORDS[i]}
+        [[ $w == = ]] && continue
+{{- template "shNodes" .Nodes}}
+    done
+
+    local -a vals=() flags=()
+    local files= dirs= dynamic=
+{{- template "shCases" .Nodes}}
+
+    if [[ -n $dynamic ]]; then
+        _{{.Func}}_dynamic
+        return
+    fi
+
+    COMPREPLY=()
+    [[ $cur == -* ]] && vals+=("${flags[@]}")
+    for w in "${vals[@]}"; do
+        [[ $w == "$cur"* ]] && COMPREPLY+=("$w")
+    done
+    if [[ -n $files || -n $dirs ]]; then
+        compopt -o filenames 2>/dev/null
+        mapfile -t -O "${#COMPREPLY[@]}" COMPREPLY < <(compgen -d -- "$cur")
+    fi
+    if [[ -n $files ]]; then
+        mapfile -t -O "${#COMPREPLY[@]}" COMPREPLY < <(compgen -f -X "!$files" -- "$cur")
+    fi
+}
+complete -F _{{.Func}}_static {{.Cmd}}
+`),
+
+	"zsh": staticScript(`# zsh completion for {{.Cmd}}, generated from its command tree
+#
+# Source it after compinit.
+_{{.Func}}_static() {
+    local cur=${words[CURRENT]} prev= node= skip= w i
+    (( CURRENT > 2 )) && prev=${words[CURRENT-1]}
+    for (( i = 2; i < CURRENT; i++ )); do
+        w=${words[i]}
+{{- template "shNodes" .Nodes}}
+    done
+
+    local -a vals=() flags=()
+    local files= dirs= dynamic=
+{{- template "shCases" .Nodes}}
+
+    if [[ -n $dynamic ]]; then
+        local -a opts
+        opts=(${(f)"$({{sh .Bin}} {{.Subcommand}} --protocol {{.Protocol}} --shell zsh -- "${(@)words[1,CURRENT]}" 2>/dev/null)"})
+        compadd -- "${opts[@]}"
+        return
+    fi
+
+    [[ $cur == -* ]] && vals+=("${flags[@]}")
+    compadd -- "${vals[@]}"
+    [[ -n $dirs ]] && _files -/
+    [[ -n $files ]] && _files -g "$files"
+}
+compdef _{{.Func}}_static {{.Cmd}}
+`),
+
+	"fish": staticScript(`
+{{- define "fishComp"}}
+{{- if .Dynamic}}set dynamic 1
+{{- else if .Dirs}}set dirs 1
+{{- else if and .Files (suffix .Pattern)}}set suffix {{fish (suffix .Pattern)}}
+{{- else if .Files}}set files 1
+{{- else if .Values}}set -a vals {{fish .Values}}
+{{- end}}
+{{- end -}}
+# fish completion for {{.Cmd}}, generated from its command tree
+function __{{.Func}}_static
+    set -l words (commandline -opc)
+    set -e words[1]
+    set -l cur (commandline -ct)
+    set -l prev
+    set -q words[1]; and set prev $words[-1]
+    set -l node ''
+{{- if or (keys .Nodes) (valueKeys .Nodes)}}
+    set -l skip
+    for w in $words
+        if set -q skip[1]
+            set skip
+            continue
+        end
+        switch "$node $w"
+{{- with valueKeys .Nodes}}
+            case {{fish .}}
+                set skip 1
+{{- end}}
+{{- with keys .Nodes}}
+            case {{fish .}}
+                set node "$node $w"
+{{- end}}
+        end
+    end
+{{- end}}
+
+    set -l vals
+    set -l flags
+    set -l files
+    set -l dirs
+    set -l suffix
+    set -l dynamic
+    switch "$node"
+{{- range .Nodes}}
+        case {{fish .Key}}
+{{- if .Dynamic}}
+            set dynamic 1
+{{- else if .Values}}
+{{- range $i, $v := .Values}}
+            {{if $i}}else {{end}}if test "$prev" = {{fish .Name}}
+                {{template "fishComp" .Comp}}
+{{- end}}
+            else
+                set vals{{with .Subs}} {{fish .}}{{end}}
+                set flags{{with .Flags}} {{fish .}}{{end}}
+{{- with .Args}}{{if or .Dynamic .Files .Dirs .Values}}
+                {{template "fishComp" .}}
+{{- end}}{{end}}
+            end
+{{- else}}
+            set vals{{with .Subs}} {{fish .}}{{end}}
+            set flags{{with .Flags}} {{fish .}}{{end}}
+{{- with .Args}}{{if or .Dynamic .Files .Dirs .Values}}
+            {{template "fishComp" .}}
+{{- end}}{{end}}
+{{- end}}
+{{- end}}
+    end
+
+    if set -q dynamic[1]
+        {{fish .Bin}} {{.Subcommand}} --protocol {{.Protocol}} --shell fish -- (commandline -opc) "$cur"
+        return
+    end
+
+    string match -q -- '-*' "$cur"; and set -a vals $flags
+    printf '%s\n' $vals
+    set -q dirs[1]; and __fish_complete_directories
+    set -q files[1]; and __fish_complete_path
+    set -q suffix[1]; and __fish_complete_suffix $suffix
+end
+complete -c {{.Cmd}} -f -a '(__{{.Func}}_static)'
+`),
+}
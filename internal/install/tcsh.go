@@ -0,0 +1,58 @@
+package install
+
+import "fmt"
+
+// (un)install in tcsh
+// basically adds/remove from .tcshrc:
+//
+// if ($?tcsh) complete <command> 'p@*@`</path/to/completion/command>`@'
+//
+// tcsh runs the command for every word, with the line up to the cursor in
+// COMMAND_LINE. '@' separates the pattern since paths are full of '/'. The rc may be
+// .cshrc, which plain csh reads too but has no 'complete', hence the check.
+type tcsh struct {
+	rc string
+}
+
+func (t tcsh) IsInstalled(cmd, bin string) bool {
+	return lineInFile(t.rc, t.cmd(cmd, bin))
+}
+
+func (t tcsh) Install(cmd, bin string) error {
+	if t.IsInstalled(cmd, bin) {
+		return fmt.Errorf("already installed in %s", t.rc)
+	}
+	// Replace the line installed before it was guarded for csh
+	if unguarded := t.unguardedCmd(cmd, bin); lineInFile(t.rc, unguarded) {
+		if err := removeFromFile(t.rc, unguarded); err != nil {
+			return err
+		}
+	}
+	return appendFile(t.rc, t.cmd(cmd, bin))
+}
+
+func (t tcsh) Uninstall(cmd, bin string) error {
+	unguarded := t.unguardedCmd(cmd, bin)
+	hasUnguarded := lineInFile(t.rc, unguarded)
+	if !hasUnguarded && !t.IsInstalled(cmd, bin) {
+		return fmt.Errorf("does not installed in %s", t.rc)
+	}
+
+	if hasUnguarded {
+		if err := removeFromFile(t.rc, unguarded); err != nil {
+			return err
+		}
+	}
+	if t.IsInstalled(cmd, bin) {
+		return removeFromFile(t.rc, t.cmd(cmd, bin))
+	}
+	return nil
+}
+
+func (t tcsh) cmd(cmd, bin string) string {
+	return "if ($?tcsh) " + t.unguardedCmd(cmd, bin)
+}
+
+func (tcsh) unguardedCmd(cmd, bin string) string {
+	return fmt.Sprintf("complete %s 'p@*@`%s`@'", cmd, bin)
+}
@@ -3,16 +3,38 @@ package install
 import (
 	"fmt"
 	"os"
+	"path/filepath"
 	"regexp"
+	"strings"
+	"unicode"
 
 	"github.com/posener/script"
 )
 
+// funcName returns 'cmd' in a form safe to use in shell function names
+func funcName(cmd string) string {
+	return strings.Map(func(r rune) rune {
+		if r == '_' || unicode.IsLetter(r) || unicode.IsDigit(r) {
+			return r
+		}
+		return '_'
+	}, filepath.Base(cmd))
+}
+
 func lineInFile(path string, line string) bool {
-	re := regexp.MustCompile("^" + regexp.QuoteMeta(line) + "$")
+	return matchInFile(path, lineRe(line))
+}
+
+// matchInFile returns true if any line of the file matches 're'
+func matchInFile(path string, re *regexp.Regexp) bool {
 	return script.Cat(path).Grep(re).Wc().Lines > 0
 }
 
+// lineRe matches exactly 'line'
+func lineRe(line string) *regexp.Regexp {
+	return regexp.MustCompile("^" + regexp.QuoteMeta(line) + "$")
+}
+
 func createFile(path string, content string) error {
 	return script.Echo(content).ToFile(path)
 }
@@ -22,13 +44,18 @@ func appendFile(path string, content string) error {
 }
 
 func removeFromFile(path string, line string) error {
+	return removeMatching(path, lineRe(line))
+}
+
+// removeMatching removes every line of the file that matches 're'
+func removeMatching(path string, re *regexp.Regexp) error {
 	backupPath := path + ".bck"
 	err := script.Cat(path).ToFile(backupPath)
 	if err != nil {
 		return fmt.Errorf("creating backup file: %s", err)
 	}
 
-	tmp, err := script.Cat(path).Modify(script.Grep{Re: regexp.MustCompile("^" + regexp.QuoteMeta(line) + "$"), Inverse: true}).ToTempFile()
+	tmp, err := script.Cat(path).Modify(script.Grep{Re: re, Inverse: true}).ToTempFile()
 	if err != nil {
 		return fmt.Errorf("failed remove: %s", err)
 	}
@@ -1,19 +1,25 @@
 package install
 
-import "fmt"
+import (
+	"fmt"
+	"regexp"
+)
 
 // (un)install in zsh
 // basically adds/remove from .zshrc:
 //
-// autoload -U +X bashcompinit && bashcompinit"
-// complete -C </path/to/completion/command> <command>
+// autoload -U +X compinit && compinit
+// _<command>_complete() { ... }; compdef _<command>_complete <command>
 type zsh struct {
 	rc string
 }
 
+const zshCompInit = "autoload -U +X compinit && compinit"
+
+// IsInstalled matches the line by its function, so that a line written for an older
+// protocol or binary is still found
 func (z zsh) IsInstalled(cmd, bin string) bool {
-	completeCmd := z.cmd(cmd, bin)
-	return lineInFile(z.rc, completeCmd)
+	return matchInFile(z.rc, z.cmdRe(cmd))
 }
 
 func (z zsh) Install(cmd, bin string) error {
@@ -21,24 +27,53 @@ func (z zsh) Install(cmd, bin string) error {
 		return fmt.Errorf("already installed in %s", z.rc)
 	}
 
+	// Replace completion installed before the native zsh function existed
+	if legacy := z.legacyCmd(cmd, bin); lineInFile(z.rc, legacy) {
+		if err := removeFromFile(z.rc, legacy); err != nil {
+			return err
+		}
+	}
+
 	completeCmd := z.cmd(cmd, bin)
-	bashCompInit := "autoload -U +X bashcompinit && bashcompinit"
-	if !lineInFile(z.rc, bashCompInit) {
-		completeCmd = bashCompInit + "\n" + completeCmd
+	if !lineInFile(z.rc, zshCompInit) {
+		completeCmd = zshCompInit + "\n" + completeCmd
 	}
 
 	return appendFile(z.rc, completeCmd)
 }
 
 func (z zsh) Uninstall(cmd, bin string) error {
-	if !z.IsInstalled(cmd, bin) {
+	legacy := z.legacyCmd(cmd, bin)
+	hasLegacy := lineInFile(z.rc, legacy)
+	if !hasLegacy && !z.IsInstalled(cmd, bin) {
 		return fmt.Errorf("does not installed in %s", z.rc)
 	}
 
-	completeCmd := z.cmd(cmd, bin)
-	return removeFromFile(z.rc, completeCmd)
+	// Both may be present if the rc file was edited by hand
+	if hasLegacy {
+		if err := removeFromFile(z.rc, legacy); err != nil {
+			return err
+		}
+	}
+	if z.IsInstalled(cmd, bin) {
+		return removeMatching(z.rc, z.cmdRe(cmd))
+	}
+	return nil
 }
 
 func (zsh) cmd(cmd, bin string) string {
+	return fmt.Sprintf(
+		`_%[1]s_complete() { local -a opts; opts=(${(f)"$(%[3]s %[4]s --protocol %[5]d --shell zsh -- "${(@)words[1,CURRENT]}")"}); compadd -- "${opts[@]}"; }; compdef _%[1]s_complete %[2]s`,
+		funcName(cmd), cmd, bin, Subcommand, CurrentProtocol("zsh"),
+	)
+}
+
+// cmdRe matches what [zsh.cmd] writes for 'cmd', whatever the binary or protocol
+func (zsh) cmdRe(cmd string) *regexp.Regexp {
+	return regexp.MustCompile("^" + regexp.QuoteMeta("_"+funcName(cmd)+"_complete() {"))
+}
+
+// legacyCmd is how completion was installed through bashcompinit
+func (zsh) legacyCmd(cmd, bin string) string {
 	return fmt.Sprintf("complete -C %s %s", bin, cmd)
 }
@@ -0,0 +1,215 @@
+package complete
+
+import (
+	"strings"
+	"time"
+	"unicode"
+	"unicode/utf8"
+)
+
+// MatchFunc returns true if 'suggestion' should be shown for what the user has
+// 'typed' so far in the current word
+type MatchFunc func(suggestion, typed string) bool
+
+// MatchPrefix is the default [MatchFunc], keeping suggestions that start with what's
+// been typed
+func MatchPrefix(suggestion, typed string) bool {
+	return strings.HasPrefix(suggestion, typed)
+}
+
+// MatchPrefixFold is like [MatchPrefix], but ignores case
+func MatchPrefixFold(suggestion, typed string) bool {
+	// Runes are compared one at a time, since folding can change their length in
+	// bytes, like 'K' (Kelvin) and 'k'
+	for _, t := range typed {
+		s, size := utf8.DecodeRuneInString(suggestion)
+		if size == 0 || !equalFold(s, t) {
+			return false
+		}
+		suggestion = suggestion[size:]
+	}
+	return true
+}
+
+// equalFold returns true if 'a' and 'b' are the same rune, ignoring case
+func equalFold(a, b rune) bool {
+	if a == b {
+		return true
+	}
+	for r := unicode.SimpleFold(a); r != a; r = unicode.SimpleFold(r) {
+		if r == b {
+			return true
+		}
+	}
+	return false
+}
+
+type options struct {
+	match          MatchFunc
+	maxSuggestions int
+	encoding       Encoding
+	timeout        time.Duration
+	logger         func(format string, args ...any)
+	envPrefix      string
+	cacheDir       func() (string, error)
+	disableInstall bool
+	installNames   []string
+	legacyBash     bool
+	lazyParse      bool
+	middleware     []Middleware
+	values         map[any]any
+	server         bool
+	serverIdle     time.Duration
+}
+
+// Option customizes a [Complete]
+type Option func(*options)
+
+// Match controls which suggestions are kept for what the user has typed. Defaults to
+// [MatchPrefix].
+func Match(fn MatchFunc) Option {
+	return func(o *options) {
+		o.match = fn
+	}
+}
+
+// MaxSuggestions limits how many suggestions are written. They're sorted first so the
+// same ones are kept each time. Zero means no limit.
+func MaxSuggestions(n int) Option {
+	return func(o *options) {
+		o.maxSuggestions = n
+	}
+}
+
+// Use wraps every predictor in the tree with middleware, in order. It runs before
+// any set on the commands themselves with [command.Command.Middleware].
+func Use(mw ...Middleware) Option {
+	return func(o *options) {
+		o.middleware = append(o.middleware, mw...)
+	}
+}
+
+// Value attaches 'val' for 'key' to every predictor, read back with
+// [args.Args.Value]. Values set on commands with [command.Command.Values] take
+// precedence.
+func Value(key, val any) Option {
+	return func(o *options) {
+		if o.values == nil {
+			o.values = map[any]any{}
+		}
+		o.values[key] = val
+	}
+}
+
+// OutputEncoding sets [Complete.Encoding]
+func OutputEncoding(enc Encoding) Option {
+	return func(o *options) {
+		o.encoding = enc
+	}
+}
+
+// Timeout gives up on predictors that take longer than 'd', returning no suggestions
+// rather than hanging the user's prompt. Zero means no timeout.
+//
+// Predictors that time out keep running in the background until they return, and
+// their directives are dropped. In a completion server, they may still be running
+// when the next request's predictors start.
+func Timeout(d time.Duration) Option {
+	return func(o *options) {
+		o.timeout = d
+	}
+}
+
+// Logger receives debug logs while completing, in place of [cmplog.Log]. That
+// includes logs written by predictors through [args.Args.Log].
+//
+// It only applies to this [Complete], so others running at the same time keep their
+// own.
+func Logger(fn func(format string, args ...any)) Option {
+	return func(o *options) {
+		o.logger = fn
+	}
+}
+
+// EnvPrefix replaces "COMP_" in the environment variables we control: INSTALL,
+// UNINSTALL, YES, DEBUG, SERVE, and GENERATE.
+//
+// COMP_LINE and COMP_POINT are set by the shell, and can't be renamed.
+func EnvPrefix(prefix string) Option {
+	return func(o *options) {
+		o.envPrefix = prefix
+	}
+}
+
+// CacheDir overrides where [predict.Cached] stores suggestions, in place of
+// [predict.UserCacheDir]. It's handed to predictors with [predict.WithCacheDir], so
+// the global is left alone.
+func CacheDir(fn func() (string, error)) Option {
+	return func(o *options) {
+		o.cacheDir = fn
+	}
+}
+
+// DisableInstall ignores requests to (un)install completion through the
+// environment, for programs that manage installation themselves
+func DisableInstall() Option {
+	return func(o *options) {
+		o.disableInstall = true
+	}
+}
+
+// InstallNames are the command names completion is installed, or generated, for. Defaults to
+// os.Args[0], or each name given to [NewMulti].
+func InstallNames(names ...string) Option {
+	return func(o *options) {
+		o.installNames = names
+	}
+}
+
+// Server completes through a long-lived process, listening on a unix socket, that
+// keeps the tree and in-memory caches warm between TABs
+//
+// The first TAB starts the server in the background, and completes as usual. Later
+// ones are forwarded to it. The server exits after 'idle' without requests, which
+// defaults to 10 minutes, or once the binary is modified so a rebuild is picked up.
+//
+// The server runs with the environment of the shell that started it. Each request
+// carries the client's working directory, found by predictors in [args.Args.Dir].
+// Predictors that use relative paths without it see the directory the server was
+// started from instead.
+//
+// The server is started by running the program again, so [Complete.Complete] must be
+// called at the very start of main, before flags are parsed or anything else runs.
+// The socket is kept in $XDG_RUNTIME_DIR, or a directory in os.TempDir() that must
+// be owned by the user and not accessible by others.
+func Server(idle time.Duration) Option {
+	return func(o *options) {
+		o.server = true
+		o.serverIdle = idle
+	}
+}
+
+// LegacyBash installs bash completion with 'complete -C', as done before a
+// completion function was installed. It can't act on directives or descriptions.
+func LegacyBash() Option {
+	return func(o *options) {
+		o.legacyBash = true
+	}
+}
+
+// LazyParse only parses arguments when a predictor calls [args.Args.Root], leaving
+// the deprecated [args.Args.ParsedRoot] field empty. Completions that never look at
+// the parsed root skip parsing altogether.
+func LazyParse() Option {
+	return func(o *options) {
+		o.lazyParse = true
+	}
+}
+
+func newOptions(opts []Option) options {
+	var o options
+	for _, fn := range opts {
+		fn(&o)
+	}
+	return o
+}
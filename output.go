@@ -0,0 +1,203 @@
+package complete
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"regexp"
+	"slices"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// Encoding controls how suggestions are separated when written out
+type Encoding int
+
+const (
+	// EncodingLines writes one suggestion per line. This is what 'complete -C'
+	// expects.
+	EncodingLines Encoding = iota
+	// EncodingNUL ends each suggestion with a NUL byte, for shells that can split on
+	// it. Suggestions may then contain newlines.
+	EncodingNUL
+)
+
+func parseEncoding(s string) (Encoding, error) {
+	switch s {
+	case "lines":
+		return EncodingLines, nil
+	case "nul":
+		return EncodingNUL, nil
+	}
+	return EncodingLines, fmt.Errorf("unknown encoding %q", s)
+}
+
+// format of suggestions understood by the installed script
+type format struct {
+	encoding Encoding
+	// descriptions are written after a tab, otherwise they're dropped
+	descriptions bool
+	// directive is written as ':N' on the last line
+	directive bool
+	// json writes a list of records with 'value' and 'description'
+	json bool
+	// replaceWord is set when the shell replaces the whole word being completed, so
+	// suggestions for '--flag=' include it
+	replaceWord bool
+	// listing is set when the shell lists suggestions instead of inserting one, so
+	// descriptions are written alongside them. They're cut to fit 'columns'.
+	listing bool
+	columns int
+	// wordbreaks are the characters bash splits words on, besides whitespace.
+	// Suggestions are trimmed to the part after the last one typed, since that's all
+	// bash replaces.
+	wordbreaks string
+}
+
+func (c *Complete) output(comp completion, f format) {
+	sep := "\n"
+	if f.encoding == EncodingNUL {
+		sep = "\x00"
+	}
+
+	trim := ""
+	if i := strings.LastIndexAny(comp.Last, f.wordbreaks); i != -1 && f.wordbreaks != "" {
+		trim = comp.Last[:i+1]
+	}
+
+	var values, descs []string
+	for _, option := range comp.Matches {
+		value, desc := splitDescription(option)
+		clean, err := sanitize(value, f.encoding)
+		if err != nil {
+			c.log("Dropping suggestion %q: %v", option, err)
+			continue
+		}
+		if desc != "" {
+			if desc, err = sanitize(desc, f.encoding); err != nil {
+				desc = ""
+			}
+		}
+		values = append(values, strings.TrimPrefix(clean, trim))
+		descs = append(descs, desc)
+	}
+	if prefix := strings.TrimSuffix(comp.Word, comp.Last); f.replaceWord && prefix != "" {
+		for i := range values {
+			values[i] = prefix + values[i]
+		}
+	}
+
+	// stdout of program defines the complete options
+	switch {
+	case f.json:
+		c.outputJSON(values, descs)
+	case f.listing && len(values) > 1:
+		for _, line := range listing(values, descs, f.columns) {
+			fmt.Fprint(c.Out, line, sep)
+		}
+	case f.listing:
+		// A single candidate is inserted by the shell, so it's kept clean
+		for _, value := range values {
+			fmt.Fprint(c.Out, value, sep)
+		}
+	default:
+		for i, value := range values {
+			if f.descriptions && descs[i] != "" {
+				value += "\t" + descs[i]
+			}
+			fmt.Fprint(c.Out, value, sep)
+		}
+	}
+
+	if f.directive {
+		fmt.Fprintf(c.Out, ":%d%s", comp.Directive, sep)
+	}
+}
+
+// record of a suggestion written as JSON
+type record struct {
+	Value       string `json:"value"`
+	Description string `json:"description,omitempty"`
+}
+
+// outputJSON writes each suggestion as a [record]
+func (c *Complete) outputJSON(values, descs []string) {
+	records := make([]record, len(values))
+	for i, value := range values {
+		records[i] = record{Value: value, Description: descs[i]}
+	}
+	if err := json.NewEncoder(c.Out).Encode(records); err != nil {
+		c.log("Writing suggestions: %v", err)
+	}
+}
+
+// listing formats suggestions as 'value -- description', with descriptions lined up
+// in a column, for shells that only show the suggestions themselves
+//
+// Lines are cut to fit within 'columns', when known.
+func listing(values, descs []string, columns int) []string {
+	if !slices.ContainsFunc(descs, func(d string) bool { return d != "" }) {
+		return values
+	}
+
+	width := 0
+	for _, v := range values {
+		width = max(width, utf8.RuneCountInString(v))
+	}
+
+	lines := make([]string, len(values))
+	for i, v := range values {
+		line := v
+		if descs[i] != "" {
+			pad := strings.Repeat(" ", width-utf8.RuneCountInString(v))
+			line = v + pad + " -- " + descs[i]
+		}
+		// Leave room for the shell's own spacing between columns
+		if runes := []rune(line); columns > 0 && len(runes) >= columns {
+			line = strings.TrimRight(string(runes[:max(columns-2, 0)]), " ") + "…"
+		}
+		lines[i] = line
+	}
+	return lines
+}
+
+// splitDescription separates a suggestion in the form "value\tdescription"
+func splitDescription(s string) (value, desc string) {
+	value, desc, _ = strings.Cut(s, "\t")
+	return value, desc
+}
+
+// Matches CSI sequences (colors, cursor movement) and OSC sequences (titles, links)
+var escapes = regexp.MustCompile(`\x1b\[[0-?]*[ -/]*[@-~]|\x1b\][^\x07\x1b]*(\x07|\x1b\\)?`)
+
+// sanitize makes a suggestion safe to print to the shell
+//
+// Suggestions often come from outside sources, like APIs or cache files. Terminal
+// escapes and control characters are removed so they can't mess with the user's
+// terminal. An error is returned when it can't be represented in the encoding.
+func sanitize(s string, enc Encoding) (string, error) {
+	if strings.ContainsRune(s, 0) {
+		return "", errors.New("contains NUL")
+	}
+	if enc == EncodingLines && strings.ContainsAny(s, "\r\n") {
+		return "", errors.New("contains newline")
+	}
+
+	s = strings.ToValidUTF8(s, string(utf8.RuneError))
+	s = escapes.ReplaceAllString(s, "")
+	s = strings.Map(func(r rune) rune {
+		if r == '\n' && enc == EncodingNUL {
+			return r
+		}
+		if unicode.IsControl(r) {
+			return -1
+		}
+		return r
+	}, s)
+
+	if s == "" {
+		return "", errors.New("empty")
+	}
+	return s, nil
+}
@@ -0,0 +1,139 @@
+package complete
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/coxley/complete/args"
+)
+
+func TestSanitize(t *testing.T) {
+	tests := []struct {
+		name string
+		in   string
+		enc  Encoding
+		want string
+		err  bool
+	}{
+		{name: "plain", in: "server1", want: "server1"},
+		{name: "unicode", in: "café", want: "café"},
+		{name: "color", in: "\x1b[31mred\x1b[0m", want: "red"},
+		{name: "title", in: "\x1b]0;pwned\x07value", want: "value"},
+		{name: "bell", in: "val\aue", want: "value"},
+		{name: "invalid utf8", in: "a\xffb", want: "a�b"},
+		{name: "newline", in: "two\nlines", err: true},
+		{name: "carriage return", in: "two\rlines", err: true},
+		{name: "nul", in: "a\x00b", err: true},
+		{name: "nul encoding nul", in: "a\x00b", enc: EncodingNUL, err: true},
+		{name: "nul encoding newline", in: "two\nlines", enc: EncodingNUL, want: "two\nlines"},
+		{name: "only escapes", in: "\x1b[0m", err: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := sanitize(tt.in, tt.enc)
+			if tt.err {
+				require.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			require.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func TestOutput(t *testing.T) {
+	b := new(bytes.Buffer)
+	c := &Complete{Out: b}
+
+	c.output(completion{Matches: []string{"a", "bad\nvalue", "\x1b[1mb\x1b[0m"}}, format{})
+	require.Equal(t, "a\nb\n", b.String())
+
+	b.Reset()
+	c.output(completion{Matches: []string{"a", "multi\nline"}}, format{encoding: EncodingNUL})
+	require.Equal(t, "a\x00multi\nline\x00", b.String())
+}
+
+func TestOutput_Format(t *testing.T) {
+	comp := completion{
+		Matches:   []string{"host:80\tweb \x1b[1mserver\x1b[0m", "host:8080"},
+		Last:      "host:8",
+		Word:      "--addr=host:8",
+		Directive: args.DirectiveNoSpace | args.DirectiveFilenames,
+	}
+
+	tests := []struct {
+		name string
+		req  request
+		want string
+	}{
+		{
+			name: "legacy",
+			req:  request{},
+			want: "host:80\nhost:8080\n",
+		},
+		{
+			name: "bash protocol 1",
+			req:  request{shell: "bash", protocol: 1, wordbreaks: ":"},
+			want: "host:80\nhost:8080\n",
+		},
+		{
+			name: "bash",
+			req:  request{shell: "bash", protocol: 2, wordbreaks: "\"'><=;|&(:"},
+			want: "80\n8080\n:3\n",
+		},
+		{
+			name: "bash listing",
+			req:  request{shell: "bash", protocol: 2, wordbreaks: ":", listing: true},
+			want: "80   -- web server\n8080\n:3\n",
+		},
+		{
+			name: "bash listing narrow",
+			req:  request{shell: "bash", protocol: 2, wordbreaks: ":", listing: true, columns: 12},
+			want: "80   -- we…\n8080\n:3\n",
+		},
+		{
+			name: "fish",
+			req:  request{shell: "fish", protocol: 2},
+			want: "--addr=host:80\tweb server\n--addr=host:8080\n",
+		},
+		{
+			name: "nu",
+			req:  request{shell: "nu", protocol: 2},
+			want: `[{"value":"--addr=host:80","description":"web server"},{"value":"--addr=host:8080"}]` + "\n",
+		},
+		{
+			name: "elvish",
+			req:  request{shell: "elvish", protocol: 2},
+			want: "--addr=host:80\tweb server\n--addr=host:8080\n:3\n",
+		},
+		{
+			name: "zsh",
+			req:  request{shell: "zsh", protocol: 2},
+			want: "--addr=host:80\n--addr=host:8080\n",
+		},
+		{
+			name: "powershell",
+			req:  request{shell: "powershell", protocol: 2},
+			want: "host:80\tweb server\nhost:8080\n",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b := new(bytes.Buffer)
+			c := &Complete{Out: b}
+			c.output(comp, tt.req.format(EncodingLines))
+			require.Equal(t, tt.want, b.String())
+		})
+	}
+
+	// A single candidate is inserted by bash, so stays clean when listing
+	b := new(bytes.Buffer)
+	c := &Complete{Out: b}
+	req := request{shell: "bash", protocol: 2, listing: true}
+	c.output(completion{Matches: []string{"prod\tProduction"}}, req.format(EncodingLines))
+	require.Equal(t, "prod\n:0\n", b.String())
+}
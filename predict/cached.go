@@ -11,7 +11,6 @@ import (
 	"time"
 
 	"github.com/coxley/complete/args"
-	"github.com/coxley/complete/cmplog"
 )
 
 const (
@@ -22,10 +21,20 @@ const (
 
 // Allow overriding for tests, but defaults to the operating system's preferred
 // location.
+//
+// Programs should use [WithCacheDir] instead, which doesn't affect others.
 var UserCacheDir = func() (string, error) {
 	return os.UserCacheDir()
 }
 
+type cacheDirKey struct{}
+
+// WithCacheDir returns a copy of 'a' where [Cached] predictors store suggestions
+// under the directory returned by 'fn', in place of [UserCacheDir]
+func WithCacheDir(a args.Args, fn func() (string, error)) args.Args {
+	return a.WithValue(cacheDirKey{}, fn)
+}
+
 // Cached returns a predictor that can re-use previous values for some time
 // until needing to regenerate.
 //
@@ -75,8 +84,8 @@ type cachePredictor struct {
 	ttl   time.Duration
 }
 
-func (p *cachePredictor) loadCache() (*cachedEntry, error) {
-	f, err := p.open()
+func (p *cachePredictor) loadCache(a args.Args) (*cachedEntry, error) {
+	f, err := p.open(a)
 	if err != nil {
 		return nil, err
 	}
@@ -113,12 +122,12 @@ func (p *cachePredictor) loadCache() (*cachedEntry, error) {
 	}, nil
 }
 
-func (p *cachePredictor) refresh(f *os.File) ([]string, error) {
+func (p *cachePredictor) refresh(a args.Args, f *os.File) ([]string, error) {
 	// Should the fill function return nothing, leave stored values unchanged to
 	// prevent intermittent issue wiping what we have.
 	values := p.load()
 	if len(values) == 0 {
-		cmplog.Log("cached pred %s:%s returned no results", p.scope, p.name)
+		a.Log("cached pred %s:%s returned no results", p.scope, p.name)
 		return nil, nil
 	}
 
@@ -139,9 +148,9 @@ func (p *cachePredictor) refresh(f *os.File) ([]string, error) {
 }
 
 func (p *cachePredictor) Predict(args args.Args) []string {
-	entry, err := p.loadCache()
+	entry, err := p.loadCache(args)
 	if err != nil {
-		cmplog.Log("cached pred %s:%s failed to load cache: %v", p.scope, p.name, err)
+		args.Log("cached pred %s:%s failed to load cache: %v", p.scope, p.name, err)
 		return nil
 	}
 
@@ -149,9 +158,9 @@ func (p *cachePredictor) Predict(args args.Args) []string {
 
 	// Refresh the cache
 	if time.Since(entry.lastUpdate) > p.ttl {
-		values, err = p.refresh(entry.file)
+		values, err = p.refresh(args, entry.file)
 		if err != nil {
-			cmplog.Log("cached pred %s:%s failed to refresh: %v", p.scope, p.name, err)
+			args.Log("cached pred %s:%s failed to refresh: %v", p.scope, p.name, err)
 			return values
 		}
 	}
@@ -171,8 +180,12 @@ func (p *cachePredictor) Predict(args args.Args) []string {
 }
 
 // filepath returns the path to the suggestions file
-func (p *cachePredictor) filepath() (string, error) {
-	cache, err := UserCacheDir()
+func (p *cachePredictor) filepath(a args.Args) (string, error) {
+	dir := UserCacheDir
+	if fn, ok := a.Value(cacheDirKey{}).(func() (string, error)); ok {
+		dir = fn
+	}
+	cache, err := dir()
 	if err != nil {
 		return "", err
 	}
@@ -186,8 +199,8 @@ func (p *cachePredictor) filepath() (string, error) {
 }
 
 // open returns a file handle to the suggestions file, creating if necessary.
-func (p *cachePredictor) open() (*os.File, error) {
-	path, err := p.filepath()
+func (p *cachePredictor) open(a args.Args) (*os.File, error) {
+	path, err := p.filepath(a)
 	if err != nil {
 		return nil, err
 	}
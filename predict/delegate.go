@@ -0,0 +1,161 @@
+package predict
+
+import (
+	"fmt"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/coxley/complete/args"
+)
+
+// Delegate returns a predictor that hands completion to the program named by the
+// first argument, like 'mycli exec -- kubectl get <TAB>'.
+//
+// The program is invoked the same way bash invokes 'complete -C' programs, with
+// COMP_LINE and COMP_POINT rebuilt from the arguments this predictor is given. The
+// line is taken from what was typed, starting at the program name, and the point is
+// shifted to match. That makes it work for any self-completing program, including
+// those using this package.
+//
+// Pair with DisableInterspersed on the wrapping command so that only the wrapped
+// command-line is given to the predictor.
+func Delegate() Predictor {
+	return Func(func(a args.Args) []string {
+		if len(a.Completed) == 0 {
+			// Still typing the program name
+			return nil
+		}
+
+		bin, err := exec.LookPath(a.Completed[0])
+		if err != nil {
+			a.Log("delegate: can't find %q: %v", a.Completed[0], err)
+			return nil
+		}
+		line, point := delegateLine(a, "")
+		return delegate(a, bin, a.All, line, point)
+	})
+}
+
+// DelegateTo returns a predictor that hands completion to 'bin', as if it were invoked
+// directly with the arguments this predictor is given.
+//
+// This is useful for plugins, like 'mycli-foo' being run as 'mycli foo'. The plugin
+// sees itself as the program being completed.
+func DelegateTo(bin string) Predictor {
+	return Func(func(a args.Args) []string {
+		name := filepath.Base(bin)
+		line, point := delegateLine(a, name+" ")
+		return delegate(a, bin, append([]string{name}, a.All...), line, point)
+	})
+}
+
+// DelegateShell is like [Delegate], but asks bash for the completion it has
+// registered for the program instead of the program itself.
+//
+// This supports programs that don't complete themselves, but have a completion
+// script installed. For example, through the bash-completion package.
+func DelegateShell() Predictor {
+	return Func(func(a args.Args) []string {
+		if len(a.Completed) == 0 {
+			return nil
+		}
+
+		bash, err := exec.LookPath("bash")
+		if err != nil {
+			a.Log("delegate: can't find bash: %v", err)
+			return nil
+		}
+
+		line, point := delegateLine(a, "")
+		argv := append([]string{"-c", bashDelegate, "bash", line, strconv.Itoa(point)}, a.All...)
+		cmd := exec.Command(bash, argv...)
+		cmd.Env = CleanEnv()
+		return run(a, cmd)
+	})
+}
+
+// delegateLine returns the line to hand the delegated program, and the cursor within
+// it, with 'prefix' put in front
+//
+// Args built by hand don't know what was typed, so their arguments are joined.
+func delegateLine(a args.Args, prefix string) (string, int) {
+	line, point := a.Line()
+	if line == "" {
+		line = strings.Join(a.All, " ")
+		point = len(line)
+	}
+	return prefix + line, len(prefix) + point
+}
+
+// delegate runs 'bin' as if bash was completing the words, including the command name
+func delegate(a args.Args, bin string, words []string, line string, point int) []string {
+	// Like 'complete -C', the program is also given the command name, the word being
+	// completed, and the word before it.
+	var prev string
+	if len(words) > 1 {
+		prev = words[len(words)-2]
+	}
+	cmd := exec.Command(bin, words[0], words[len(words)-1], prev)
+	cmd.Env = append(
+		CleanEnv(),
+		"COMP_LINE="+line,
+		fmt.Sprintf("COMP_POINT=%d", point),
+	)
+	return run(a, cmd)
+}
+
+// run executes 'cmd' from the user's directory, returning each non-empty line of
+// output as a suggestion
+func run(a args.Args, cmd *exec.Cmd) []string {
+	cmd.Dir = a.Dir()
+	a.Log("delegate: running %q", cmd.Args)
+	out, err := cmd.Output()
+	if err != nil {
+		a.Log("delegate: %q failed: %v", cmd.Args, err)
+		return nil
+	}
+
+	var suggestions []string
+	for _, s := range strings.Split(string(out), "\n") {
+		if s != "" {
+			suggestions = append(suggestions, s)
+		}
+	}
+	return suggestions
+}
+
+// bashDelegate loads the completion spec that bash has for a command and prints
+// the results. It's given the command-line and cursor, followed by each word in it.
+const bashDelegate = `
+COMP_LINE=$1
+COMP_POINT=$2
+COMP_WORDS=("${@:3}")
+COMP_CWORD=$(( ${#COMP_WORDS[@]} - 1 ))
+cmd=${COMP_WORDS[0]}
+
+for f in /usr/share/bash-completion/bash_completion /etc/bash_completion \
+	/usr/local/etc/profile.d/bash_completion.sh /opt/homebrew/etc/profile.d/bash_completion.sh; do
+	if [[ -f $f ]]; then
+		. "$f"
+		break
+	fi
+done
+
+if type __load_completion &>/dev/null; then
+	__load_completion "$cmd"
+elif type _completion_loader &>/dev/null; then
+	_completion_loader "$cmd"
+fi
+
+spec=$(complete -p "$cmd" 2>/dev/null) || exit 0
+cur=${COMP_WORDS[COMP_CWORD]}
+prev=${COMP_WORDS[COMP_CWORD-1]}
+if [[ $spec =~ -F\ ([^ ]+) ]]; then
+	"${BASH_REMATCH[1]}" "$cmd" "$cur" "$prev"
+	printf '%s\n' "${COMPREPLY[@]}"
+elif [[ $spec =~ -C\ ([^ ]+) ]]; then
+	COMP_LINE=$COMP_LINE COMP_POINT=$COMP_POINT "${BASH_REMATCH[1]}" "$cmd" "$cur" "$prev"
+fi
+`
@@ -0,0 +1,25 @@
+package predict
+
+import (
+	"os"
+	"slices"
+	"strings"
+
+	"github.com/coxley/complete/cmplog"
+)
+
+// CleanEnv returns the environment without the variables used to request
+// completion, like COMP_LINE and COMP_POINT, or COMMAND_LINE from tcsh.
+//
+// Predictors that run other programs should use this for exec.Cmd.Env. Otherwise
+// a child built with this package would print suggestions instead of doing its job.
+// [cmplog.Env] is kept so debugging carries through.
+func CleanEnv() []string {
+	return slices.DeleteFunc(os.Environ(), func(kv string) bool {
+		name, _, _ := strings.Cut(kv, "=")
+		if name == "COMMAND_LINE" {
+			return true
+		}
+		return strings.HasPrefix(name, "COMP_") && name != cmplog.Env
+	})
+}
@@ -19,40 +19,58 @@ func Dirs(pattern string) Predictor {
 // be typed path, if no path was started to be typed, it will complete to files that
 // match the pattern in the current working directory.
 // To match any file, use "*" as pattern. To match go files use "*.go", and so on.
+//
+// With "*", the shell is asked to complete file names itself when nothing matches,
+// with [args.DirectiveDefault]. It understands paths we don't, like "~/".
 func Files(pattern string) Predictor {
 	return files(pattern, true)
 }
 
 func files(pattern string, allowFiles bool) Predictor {
+	return predictFilesFor{pattern: pattern, allowFiles: allowFiles}
+}
+
+// predictFilesFor is kept as its own type so [FilePattern] can find the pattern
+type predictFilesFor struct {
+	pattern    string
+	allowFiles bool
+}
+
+func (p predictFilesFor) Predict(a args.Args) (prediction []string) {
 	// search for files according to arguments,
 	// if only one directory has matched the result, search recursively into
 	// this directory to give more results.
-	return Func(func(a args.Args) (prediction []string) {
-		prediction = predictFiles(a, pattern, allowFiles)
+	a.SetDirective(args.DirectiveFilenames)
+	wd := a.Dir()
+	prediction = predictFiles(a, wd, p.pattern, p.allowFiles)
 
-		// if the number of prediction is not 1, we either have many results or
-		// have no results, so we return it.
-		if len(prediction) != 1 {
-			return
-		}
+	// Any file the shell finds would match too
+	if len(prediction) == 0 && p.allowFiles && p.pattern == "*" {
+		a.SetDirective(args.DirectiveDefault)
+	}
 
-		// only try deeper, if the one item is a directory
-		if stat, err := os.Stat(prediction[0]); err != nil || !stat.IsDir() {
-			return
-		}
+	// if the number of prediction is not 1, we either have many results or
+	// have no results, so we return it.
+	if len(prediction) != 1 {
+		return
+	}
 
-		a.Last = prediction[0]
-		return predictFiles(a, pattern, allowFiles)
-	})
+	// only try deeper, if the one item is a directory
+	if stat, err := os.Stat(resolve(wd, prediction[0])); err != nil || !stat.IsDir() {
+		return
+	}
+
+	a.Last = prediction[0]
+	return predictFiles(a, wd, p.pattern, p.allowFiles)
 }
 
-func predictFiles(a args.Args, pattern string, allowFiles bool) []string {
+func predictFiles(a args.Args, wd, pattern string, allowFiles bool) []string {
 	if strings.HasSuffix(a.Last, "/..") {
 		return nil
 	}
 
-	dir := directory(a.Last)
-	files := listFiles(dir, pattern, allowFiles)
+	dir := directory(wd, a.Last)
+	files := listFiles(resolve(wd, dir), pattern, allowFiles)
 
 	// add dir if match
 	files = append(files, dir)
@@ -62,23 +80,34 @@ func predictFiles(a args.Args, pattern string, allowFiles bool) []string {
 
 // directory gives the directory of the given partial path
 // in case that it is not, we fall back to the current directory.
-func directory(path string) string {
-	if info, err := os.Stat(path); err == nil && info.IsDir() {
-		return fixPathForm(path, path)
+func directory(wd, path string) string {
+	if info, err := os.Stat(resolve(wd, path)); err == nil && info.IsDir() {
+		return fixPathForm(wd, path, path)
 	}
 	dir := filepath.Dir(path)
-	if info, err := os.Stat(dir); err == nil && info.IsDir() {
-		return fixPathForm(path, dir)
+	if info, err := os.Stat(resolve(wd, dir)); err == nil && info.IsDir() {
+		return fixPathForm(wd, path, dir)
 	}
 	return "./"
 }
 
+// resolve returns 'path' relative to 'wd', unless it's absolute
+func resolve(wd, path string) string {
+	if filepath.IsAbs(path) {
+		return filepath.Clean(path)
+	}
+	return filepath.Join(wd, path)
+}
+
 // FileSet predict according to file rules to a given set of file names
+//
+// Relative names are from [args.Args.Dir].
 func FileSet(files []string) Predictor {
 	return Func(func(a args.Args) (prediction []string) {
+		wd := a.Dir()
 		// add all matching files to prediction
 		for _, f := range files {
-			f = fixPathForm(a.Last, f)
+			f = fixPathForm(wd, a.Last, f)
 
 			// test matching of file to the argument
 			if matchFile(f, a.Last) {
@@ -134,25 +163,16 @@ func matchFile(file, prefix string) bool {
 	return strings.HasPrefix(file, prefix)
 }
 
-// fixPathForm changes a file name to a relative name
-func fixPathForm(last string, file string) string {
-	// get wording directory for relative name
-	workDir, err := os.Getwd()
-	if err != nil {
-		return file
-	}
-
-	abs, err := filepath.Abs(file)
-	if err != nil {
-		return file
-	}
+// fixPathForm changes a file name to a name relative to 'wd'
+func fixPathForm(wd, last string, file string) string {
+	abs := resolve(wd, file)
 
 	// if last is absolute, return path as absolute
 	if filepath.IsAbs(last) {
-		return fixDirPath(abs)
+		return fixDirPath(wd, abs)
 	}
 
-	rel, err := filepath.Rel(workDir, abs)
+	rel, err := filepath.Rel(wd, abs)
 	if err != nil {
 		return file
 	}
@@ -162,11 +182,11 @@ func fixPathForm(last string, file string) string {
 		rel = "./" + rel
 	}
 
-	return fixDirPath(rel)
+	return fixDirPath(wd, rel)
 }
 
-func fixDirPath(path string) string {
-	info, err := os.Stat(path)
+func fixDirPath(wd, path string) string {
+	info, err := os.Stat(resolve(wd, path))
 	if err == nil && info.IsDir() && !strings.HasSuffix(path, "/") {
 		path += "/"
 	}
@@ -1,6 +1,9 @@
 package predict
 
 import (
+	"runtime/debug"
+	"sync"
+
 	"github.com/coxley/complete/args"
 )
 
@@ -21,12 +24,48 @@ func Or(predictors ...Predictor) Predictor {
 			if p == nil {
 				continue
 			}
-			prediction = append(prediction, p.Predict(a)...)
+			// One misbehaving predictor shouldn't hide the others
+			prediction = append(prediction, safePredict(p, a)...)
 		}
 		return
 	})
 }
 
+// Recover returns a predictor that survives panics in 'p'. The panic and its stack
+// are logged with [args.Args.Log], and no suggestions are returned in its place.
+//
+// Otherwise, a Go stack trace would be printed in the middle of the user's prompt.
+func Recover(p Predictor) Predictor {
+	return Func(func(a args.Args) []string {
+		return safePredict(p, a)
+	})
+}
+
+// Lazy returns a predictor built by 'fn' the first time it's needed
+//
+// This keeps heavy dependencies, like API clients, out of start-up when the user
+// isn't completing the flag or argument that needs them.
+func Lazy(fn func() Predictor) Predictor {
+	get := sync.OnceValue(fn)
+	return Func(func(a args.Args) []string {
+		p := get()
+		if p == nil {
+			return nil
+		}
+		return p.Predict(a)
+	})
+}
+
+func safePredict(p Predictor, a args.Args) (prediction []string) {
+	defer func() {
+		if r := recover(); r != nil {
+			a.Log("predictor panicked: %v\n%s", r, debug.Stack())
+			prediction = nil
+		}
+	}()
+	return p.Predict(a)
+}
+
 // Func determines what terms can follow a command or a flag
 // It is used for auto completion, given last - the last word in the already
 // in the command line, what words can complete it.
@@ -2,6 +2,9 @@ package predict
 
 import (
 	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
 	"sort"
 	"strings"
 	"testing"
@@ -10,6 +13,7 @@ import (
 	"github.com/stretchr/testify/require"
 
 	"github.com/coxley/complete/args"
+	"github.com/coxley/complete/cmplog"
 	"github.com/coxley/complete/internal"
 )
 
@@ -174,6 +178,34 @@ func TestPredicate(t *testing.T) {
 	}
 }
 
+func TestFiles_Default(t *testing.T) {
+	t.Parallel()
+	internal.Chdir(t)
+
+	// Nothing here, but the shell may know better, like for '~/'
+	a := args.New("cmd ~/", nil)
+	require.Empty(t, Files("*").Predict(a))
+	require.Equal(t, args.DirectiveDefault, a.Directive()&args.DirectiveDefault)
+
+	// The shell would suggest files that don't match the pattern
+	a = args.New("cmd ~/", nil)
+	require.Empty(t, Files("*.go").Predict(a))
+	require.Zero(t, a.Directive()&args.DirectiveDefault)
+
+	a = args.New("cmd a.", nil)
+	require.NotEmpty(t, Files("*").Predict(a))
+	require.Zero(t, a.Directive()&args.DirectiveDefault)
+}
+
+func TestFiles_Dir(t *testing.T) {
+	t.Parallel()
+	internal.Chdir(t)
+
+	// Resolved from the given directory, rather than the working one
+	a := args.New("cmd ", nil).WithDir("outer")
+	require.ElementsMatch(t, []string{"./", "inner/"}, Dirs("*").Predict(a))
+}
+
 func TestCached(t *testing.T) {
 	t.Parallel()
 	internal.SetupLogging()
@@ -293,3 +325,142 @@ func TestMatchFile(t *testing.T) {
 		}
 	}
 }
+
+func TestDelegate(t *testing.T) {
+	t.Parallel()
+	internal.SetupLogging()
+
+	// Stand-in for a self-completing program that echoes what it was given
+	dir := t.TempDir()
+	bin := filepath.Join(dir, "wrapped")
+	script := "#!/bin/sh\necho \"$COMP_LINE|$COMP_POINT\"\necho \"$1|$2|$3\"\n"
+	require.NoError(t, os.WriteFile(bin, []byte(script), 0o755))
+
+	// As if 'mycli exec -- /path/to/wrapped get po' was typed
+	a := args.New("mycli exec -- "+bin+" get po", nil).From(1)
+	got := Delegate().Predict(a)
+	line := bin + " get po"
+	require.Equal(t, []string{fmt.Sprintf("%s|%d", line, len(line)), bin + "|po|get"}, got)
+
+	// The '=' split off for completion is kept in the line
+	a = args.New("mycli exec -- "+bin+" --ns=kube", nil).From(1)
+	got = Delegate().Predict(a)
+	line = bin + " --ns=kube"
+	require.Equal(t, []string{fmt.Sprintf("%s|%d", line, len(line)), bin + "|kube|--ns"}, got)
+
+	// Nothing to do while the program name is being typed
+	require.Empty(t, Delegate().Predict(args.New("mycli exec -- wra", nil).From(1)))
+}
+
+func TestDelegateTo(t *testing.T) {
+	t.Parallel()
+	internal.SetupLogging()
+
+	dir := t.TempDir()
+	bin := filepath.Join(dir, "mycli-foo")
+	script := "#!/bin/sh\necho \"$COMP_LINE|$COMP_POINT\"\n"
+	require.NoError(t, os.WriteFile(bin, []byte(script), 0o755))
+
+	// As if 'mycli foo  --out=fi' was typed, with the plugin seeing itself
+	a := args.New("mycli foo  --out=fi", nil).From(0)
+	line := "mycli-foo --out=fi"
+	require.Equal(t, []string{fmt.Sprintf("%s|%d", line, len(line))}, DelegateTo(bin).Predict(a))
+}
+
+func TestDelegateShell(t *testing.T) {
+	internal.SetupLogging()
+	if _, err := exec.LookPath("bash"); err != nil {
+		t.Skip("bash isn't installed")
+	}
+
+	// Non-interactive bash reads BASH_ENV, standing in for an installed completion
+	rc := filepath.Join(t.TempDir(), "completion.bash")
+	script := `_wrapped() { COMPREPLY=("$COMP_LINE|$COMP_POINT" "$1|$2|$3"); }
+complete -F _wrapped wrapped
+`
+	require.NoError(t, os.WriteFile(rc, []byte(script), 0o644))
+	t.Setenv("BASH_ENV", rc)
+
+	a := args.New("mycli exec -- wrapped  get po", nil).From(1)
+	line := "wrapped  get po"
+	got := DelegateShell().Predict(a)
+	require.Equal(t, []string{fmt.Sprintf("%s|%d", line, len(line)), "wrapped|po|get"}, got)
+
+	require.Empty(t, DelegateShell().Predict(args.New("mycli exec -- ", nil).From(1)))
+}
+
+func TestCleanEnv(t *testing.T) {
+	t.Setenv("COMP_LINE", "mycli ")
+	t.Setenv("COMP_POINT", "6")
+	t.Setenv("COMMAND_LINE", "mycli ")
+	t.Setenv(cmplog.Env, "1")
+	t.Setenv("OTHER", "kept")
+
+	env := CleanEnv()
+	require.NotContains(t, env, "COMP_LINE=mycli ")
+	require.NotContains(t, env, "COMP_POINT=6")
+	require.NotContains(t, env, "COMMAND_LINE=mycli ")
+	require.Contains(t, env, cmplog.Env+"=1")
+	require.Contains(t, env, "OTHER=kept")
+}
+
+func TestRecover(t *testing.T) {
+	t.Parallel()
+	internal.SetupLogging()
+
+	var root *struct{ names []string }
+	panics := Func(func(args.Args) []string {
+		return root.names
+	})
+
+	require.Empty(t, Recover(panics).Predict(args.New("cmd ", nil)))
+
+	// Other predictors still contribute
+	got := Or(Set("a"), panics, Set("b")).Predict(args.New("cmd ", nil))
+	require.Equal(t, []string{"a", "b"}, got)
+}
+
+func TestLazy(t *testing.T) {
+	t.Parallel()
+
+	built := 0
+	p := Lazy(func() Predictor {
+		built++
+		return Set("a", "b")
+	})
+	require.Equal(t, 0, built, "built before being used")
+
+	a := args.New("cmd ", nil)
+	require.Equal(t, []string{"a", "b"}, p.Predict(a))
+	require.Equal(t, []string{"a", "b"}, p.Predict(a))
+	require.Equal(t, 1, built)
+
+	require.Empty(t, Lazy(func() Predictor { return nil }).Predict(a))
+}
+
+func TestStatic(t *testing.T) {
+	t.Parallel()
+
+	values, ok := StaticValues(Set("a", "b"))
+	require.True(t, ok)
+	require.Equal(t, []string{"a", "b"}, values)
+
+	values, ok = StaticValues(Anything)
+	require.True(t, ok)
+	require.Empty(t, values)
+
+	_, ok = StaticValues(Func(func(args.Args) []string { return nil }))
+	require.False(t, ok)
+
+	pattern, dirs, ok := FilePattern(Files("*.go"))
+	require.True(t, ok)
+	require.Equal(t, "*.go", pattern)
+	require.False(t, dirs)
+
+	_, dirs, ok = FilePattern(Dirs("*"))
+	require.True(t, ok)
+	require.True(t, dirs)
+
+	_, _, ok = FilePattern(Set("a"))
+	require.False(t, ok)
+}
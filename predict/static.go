@@ -0,0 +1,28 @@
+package predict
+
+// StaticValues returns what 'p' suggests when it doesn't depend on what's been typed,
+// such as with [Set] or [Anything]
+//
+// ok is false for any other predictor, which has to be run to know.
+func StaticValues(p Predictor) (values []string, ok bool) {
+	switch p := p.(type) {
+	case predictSet:
+		return p, true
+	case *wrapped:
+		if p == Anything {
+			return nil, true
+		}
+	}
+	return nil, false
+}
+
+// FilePattern returns the pattern given to [Files] or [Dirs], and whether 'p' only
+// suggests directories
+//
+// ok is false for any other predictor.
+func FilePattern(p Predictor) (pattern string, dirs bool, ok bool) {
+	if p, is := p.(predictFilesFor); is {
+		return p.pattern, !p.allowFiles, true
+	}
+	return "", false, false
+}
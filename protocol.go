@@ -0,0 +1,218 @@
+package complete
+
+import (
+	"flag"
+	"io"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/coxley/complete/args"
+	"github.com/coxley/complete/internal/install"
+)
+
+// request describes what the shell asked to have completed
+type request struct {
+	line  string
+	point int
+	// words are set when the shell split the line itself, up to and including the
+	// word at the cursor. They're used in place of splitting 'line'.
+	words []string
+	// shell is known when invoked through [install.Subcommand], or for tcsh from
+	// COMMAND_LINE
+	shell string
+	// protocol is the version the installed script speaks, or 0 when using COMP_LINE
+	protocol int
+	// encoding overrides [Complete.Encoding] when set
+	encoding *Encoding
+	// wordbreaks is COMP_WORDBREAKS, passed along by the bash script
+	wordbreaks string
+	// listing is set when bash is listing suggestions rather than inserting one, as
+	// told by COMP_TYPE. columns is the width of the terminal, if known.
+	listing bool
+	columns int
+	// dir is where the user is completing from, when it isn't our working directory
+	dir string
+}
+
+// withDir gives 'a' the directory of the request, if it has one
+func (r request) withDir(a args.Args) args.Args {
+	if r.dir == "" {
+		return a
+	}
+	return a.WithDir(r.dir)
+}
+
+// format returns how suggestions should be written for the installed script
+func (r request) format(enc Encoding) format {
+	f := format{encoding: enc}
+	switch r.shell {
+	case "bash":
+		// Older scripts used 'complete -C', which can't act on any of this
+		// Descriptions would be inserted into the line along with the value, so
+		// they're only written when listing.
+		if r.protocol >= 2 {
+			f.directive = true
+			f.wordbreaks = r.wordbreaks
+			f.listing = r.listing
+			f.columns = r.columns
+		}
+	case "nu":
+		f.json = true
+		f.replaceWord = true
+	case "elvish":
+		f.descriptions = true
+		f.directive = true
+		f.replaceWord = true
+	case "fish":
+		// Anything after a tab is shown as the description, and the whole token is
+		// matched against suggestions, even after '='
+		f.descriptions = true
+		f.replaceWord = true
+	case "powershell":
+		// The script puts back what came before '=' itself
+		f.descriptions = true
+	case "zsh", "tcsh":
+		// The whole word is matched against suggestions, even after '='
+		f.replaceWord = true
+	}
+	return f
+}
+
+// IsRequest returns true if the program may have been invoked for completion: to
+// complete the command-line, or to install, generate, or serve it
+//
+// It's cheap enough to call before anything else in main, so that programs can skip
+// expensive start-up work that completion doesn't need. It can't tell whether
+// COMP_LINE was inherited from a parent being completed, or whether installing was
+// disabled, so still fall through when [Complete.Complete] returns false:
+//
+//	func main() {
+//		if complete.IsRequest() && complete.New2(complete.Lazy(newParser)).Complete() {
+//			return
+//		}
+//		loadConfig()
+//		...
+//	}
+//
+// Give it the same [EnvPrefix] as the completer, if any. Other options are ignored.
+func IsRequest(opts ...Option) bool {
+	if len(os.Args) > 1 && os.Args[1] == install.Subcommand {
+		return true
+	}
+	c := &Complete{options: newOptions(opts)}
+	names := []string{envLine, envCommandLine}
+	for _, name := range []string{"INSTALL", "UNINSTALL", "GENERATE", "SERVE"} {
+		names = append(names, c.env(name))
+	}
+	for _, name := range names {
+		if os.Getenv(name) != "" {
+			return true
+		}
+	}
+	return false
+}
+
+// request returns what needs completing, and false if completion wasn't requested
+func (c *Complete) request() (request, bool) {
+	if req, ok := c.parseArgs(os.Args[1:]); ok {
+		c.checkProtocol(req)
+		return req, true
+	}
+
+	req, ok := c.getEnv()
+	if !ok {
+		return request{}, false
+	}
+
+	// Children started from here on, like by predictors, shouldn't think they're
+	// being completed too
+	os.Unsetenv(envLine)
+	os.Unsetenv(envPoint)
+	os.Unsetenv(envCommandLine)
+
+	if !c.isSelf(req.line) {
+		c.log("Ignoring %s meant for another program: %s", envLine, req.line)
+		return request{}, false
+	}
+	return req, true
+}
+
+// parseArgs parses an invocation of the hidden sub-command, which looks like:
+//
+//	mycli __complete --protocol 1 --shell zsh [--point N] [--encoding nul] -- mycli sub --fl
+//
+// A single argument after "--" is the line as typed, like COMP_LINE, and 'point' is
+// the cursor position within it. It defaults to the end.
+//
+// Several arguments are the words as split by the shell, ending with the one at the
+// cursor. They're kept whole, so quoted words can contain spaces, and 'point' is
+// ignored since it can't refer to them.
+func (c *Complete) parseArgs(argv []string) (request, bool) {
+	if len(argv) == 0 || argv[0] != install.Subcommand {
+		return request{}, false
+	}
+	argv = argv[1:]
+
+	// Find the words ourselves so that even if a newer script passes flags we don't
+	// understand, we can still do our best.
+	var words []string
+	if i := slices.Index(argv, "--"); i != -1 {
+		argv, words = argv[:i], argv[i+1:]
+	}
+
+	req := request{point: -1}
+	fs := flag.NewFlagSet(install.Subcommand, flag.ContinueOnError)
+	fs.SetOutput(io.Discard)
+	fs.StringVar(&req.shell, "shell", "", "shell requesting completion")
+	fs.IntVar(&req.point, "point", -1, "cursor position in the line")
+	fs.IntVar(&req.protocol, "protocol", 0, "protocol version of the installed script")
+	fs.Func("encoding", "how to separate suggestions", func(v string) error {
+		enc, err := parseEncoding(v)
+		req.encoding = &enc
+		return err
+	})
+	if err := fs.Parse(argv); err != nil {
+		c.log("Failed parsing %s args %q: %v", install.Subcommand, argv, err)
+	}
+
+	if req.shell == "bash" {
+		req.wordbreaks = os.Getenv(envWordbreaks)
+		// '?' lists suggestions after a repeated TAB. Other types insert them.
+		req.listing = os.Getenv(envType) == "63"
+		req.columns, _ = strconv.Atoi(os.Getenv("COLUMNS"))
+	}
+
+	req.line = strings.Join(words, " ")
+	if len(words) > 1 {
+		req.words = words
+		req.point = len(req.line)
+	}
+	if req.point < 0 || req.point > len(req.line) {
+		req.point = len(req.line)
+	}
+	return req, true
+}
+
+// checkProtocol notes when the installed script and program disagree on the
+// protocol version
+//
+// Older scripts are still served in the format they expect, and are only outdated
+// if the script for their shell has changed since. Newer scripts are served as best
+// we can.
+func (c *Complete) checkProtocol(req request) {
+	switch {
+	case req.protocol < install.CurrentProtocol(req.shell):
+		// Installing again fails while the old script is in place
+		c.log(
+			"Installed %s completion is outdated (protocol %d, current %d), reinstall with %s=1 and then %s=1",
+			req.shell, req.protocol, install.CurrentProtocol(req.shell), c.env("UNINSTALL"), c.env("INSTALL"),
+		)
+	case req.protocol > install.ProtocolVersion:
+		c.log(
+			"Installed %s completion is newer than this program (protocol %d, supported %d)",
+			req.shell, req.protocol, install.ProtocolVersion,
+		)
+	}
+}
@@ -0,0 +1,237 @@
+package complete
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"io/fs"
+	"net"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"time"
+
+	"github.com/coxley/complete/internal/install"
+	"github.com/coxley/complete/predict"
+)
+
+const (
+	// defaultIdle is how long a server waits for requests before exiting
+	defaultIdle = 10 * time.Minute
+	// dialTimeout is kept short so a missing server doesn't slow the prompt down
+	dialTimeout = 50 * time.Millisecond
+	// requestTimeout bounds a single request, from either side
+	requestTimeout = 10 * time.Second
+)
+
+// serverRequest is sent by the client for each TAB
+type serverRequest struct {
+	Line  string   `json:"line"`
+	Point int      `json:"point"`
+	Words []string `json:"words,omitempty"`
+	// Dir is the working directory of the client, so predictors like [predict.Files]
+	// see the same files
+	Dir string `json:"dir"`
+}
+
+type serverResponse struct {
+	completion
+	// Stale is set when the binary has changed since the server started. The client
+	// should complete by itself, and start a new server.
+	Stale bool `json:"stale,omitempty"`
+}
+
+// remote asks the completion server for suggestions, starting one in the background
+// if it isn't running
+//
+// ok is false when the caller should complete in-process instead.
+func (c *Complete) remote(req request) (comp completion, ok bool) {
+	exe, err := os.Executable()
+	if err != nil {
+		c.log("Can't find executable for server: %v", err)
+		return comp, false
+	}
+	sock, err := socketPath(exe)
+	if err != nil {
+		c.log("Can't create socket directory: %v", err)
+		return comp, false
+	}
+
+	dir, _ := os.Getwd()
+	resp, err := ask(sock, serverRequest{Line: req.line, Point: req.point, Words: req.words, Dir: dir})
+	if err != nil || resp.Stale {
+		c.log("Server unavailable, starting one: err=%v, stale=%t", err, resp.Stale)
+		c.spawn(exe, sock)
+		return comp, false
+	}
+	return resp.completion, true
+}
+
+// ask sends a single request to the server listening on 'sock'
+func ask(sock string, req serverRequest) (resp serverResponse, err error) {
+	conn, err := net.DialTimeout("unix", sock, dialTimeout)
+	if err != nil {
+		return resp, err
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(requestTimeout))
+
+	if err := json.NewEncoder(conn).Encode(req); err != nil {
+		return resp, err
+	}
+	err = json.NewDecoder(conn).Decode(&resp)
+	return resp, err
+}
+
+// spawn starts a server for 'exe' in the background, without waiting on it
+//
+// It's run the same way the shell runs it to complete, so a program that doesn't
+// call [Complete.Complete] before anything else fails on an unknown sub-command
+// rather than doing whatever it does by default.
+func (c *Complete) spawn(exe, sock string) {
+	cmd := exec.Command(exe, install.Subcommand)
+	cmd.Env = append(predict.CleanEnv(), c.env("SERVE")+"="+sock)
+	detach(cmd)
+	if err := cmd.Start(); err != nil {
+		c.log("Starting server: %v", err)
+		return
+	}
+	cmd.Process.Release()
+}
+
+// runServer serves completions on 'sock' until idle, or the binary changes
+func (c *Complete) runServer(sock string) error {
+	exe, err := os.Executable()
+	if err != nil {
+		return err
+	}
+
+	// Another server may have won the race to start
+	if conn, err := net.DialTimeout("unix", sock, dialTimeout); err == nil {
+		conn.Close()
+		return nil
+	}
+	os.Remove(sock)
+
+	l, err := net.Listen("unix", sock)
+	if err != nil {
+		return err
+	}
+	return c.serve(l, exe)
+}
+
+// serve handles requests one at a time, so predictors don't need to be safe to run
+// concurrently, unless they can outlive a request by timing out. See [Timeout].
+//
+// It returns once no requests arrive for the idle timeout, or 'exe' is modified.
+func (c *Complete) serve(l net.Listener, exe string) error {
+	defer l.Close()
+
+	started, err := modTime(exe)
+	if err != nil {
+		return err
+	}
+	idle := c.options.serverIdle
+	if idle <= 0 {
+		idle = defaultIdle
+	}
+
+	for {
+		if dl, ok := l.(interface{ SetDeadline(time.Time) error }); ok {
+			dl.SetDeadline(time.Now().Add(idle))
+		}
+		conn, err := l.Accept()
+		if errors.Is(err, os.ErrDeadlineExceeded) {
+			c.log("Server idle for %s, exiting", idle)
+			return nil
+		} else if err != nil {
+			return err
+		}
+
+		mtime, err := modTime(exe)
+		stale := err != nil || !mtime.Equal(started)
+		if stale {
+			// Stop listening first, so the replacement doesn't find us
+			c.log("Binary changed, exiting")
+			l.Close()
+		}
+		c.handle(conn, stale)
+		if stale {
+			return nil
+		}
+	}
+}
+
+// handle a single request
+func (c *Complete) handle(conn net.Conn, stale bool) {
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(requestTimeout))
+
+	var req serverRequest
+	if err := json.NewDecoder(conn).Decode(&req); err != nil {
+		c.log("Decoding request: %v", err)
+		return
+	}
+
+	resp := serverResponse{Stale: stale}
+	if !stale {
+		if cmd, parser, ok := c.tree(req.Line); ok {
+			r := request{line: req.Line, point: req.Point, words: req.Words, dir: req.Dir}
+			resp.completion = c.suggest(cmd, parser, r)
+		}
+	}
+	if err := json.NewEncoder(conn).Encode(resp); err != nil {
+		c.log("Encoding response: %v", err)
+	}
+}
+
+// socketPath returns where the server for 'exe' listens, private to the user
+func socketPath(exe string) (string, error) {
+	dir, err := socketDir()
+	if err != nil {
+		return "", err
+	}
+
+	// Binaries of the same name in different places get their own server
+	h := fnv.New32a()
+	h.Write([]byte(exe))
+	return filepath.Join(dir, fmt.Sprintf("%s-%x.sock", filepath.Base(exe), h.Sum32())), nil
+}
+
+// socketDir returns a directory for sockets that only the user can access
+//
+// $XDG_RUNTIME_DIR is preferred, since it's already private. Otherwise, the temporary
+// directory is shared, so another user could create ours first.
+func socketDir() (string, error) {
+	dir := filepath.Join(os.TempDir(), fmt.Sprintf("complete-%d", os.Getuid()))
+	if runtime := os.Getenv("XDG_RUNTIME_DIR"); runtime != "" {
+		dir = filepath.Join(runtime, "complete")
+	}
+	if err := os.Mkdir(dir, 0o700); err != nil && !errors.Is(err, fs.ErrExist) {
+		return "", err
+	}
+
+	info, err := os.Lstat(dir)
+	if err != nil {
+		return "", err
+	}
+	if !info.IsDir() {
+		return "", fmt.Errorf("%s: not a directory", dir)
+	}
+	if perm := info.Mode().Perm(); perm != 0o700 {
+		return "", fmt.Errorf("%s: mode is %s, not 0700", dir, perm)
+	}
+	if err := checkOwner(info); err != nil {
+		return "", fmt.Errorf("%s: %w", dir, err)
+	}
+	return dir, nil
+}
+
+func modTime(path string) (time.Time, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return time.Time{}, err
+	}
+	return info.ModTime(), nil
+}
@@ -0,0 +1,16 @@
+//go:build !unix
+
+package complete
+
+import (
+	"io/fs"
+	"os/exec"
+)
+
+// detach is a no-op where sessions aren't supported
+func detach(cmd *exec.Cmd) {}
+
+// checkOwner is a no-op where files don't have a uid
+func checkOwner(info fs.FileInfo) error {
+	return nil
+}
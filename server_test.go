@@ -0,0 +1,162 @@
+//go:build unix
+
+package complete
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/coxley/complete/internal"
+)
+
+func TestServer(t *testing.T) {
+	internal.Chdir(t)
+
+	// Stands in for the binary, so we can "rebuild" it
+	exe := filepath.Join(t.TempDir(), "cmd")
+	if err := os.WriteFile(exe, nil, 0o755); err != nil {
+		t.Fatal(err)
+	}
+
+	// Short, since unix socket paths are limited in length
+	sockDir, err := os.MkdirTemp("", "cmp")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.RemoveAll(sockDir) })
+	sock := filepath.Join(sockDir, "s")
+	l, err := net.Listen("unix", sock)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	c := New2(NopParser(Command{
+		Sub: Commands{"sub1": {}, "sub2": {}},
+	}), Server(time.Minute))
+	done := make(chan error, 1)
+	go func() {
+		done <- c.serve(l, exe)
+	}()
+
+	dir, _ := os.Getwd()
+	resp, err := ask(sock, serverRequest{Line: "cmd sub", Point: -1, Dir: dir})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.Stale || !equalSlices(slices.Sorted(slices.Values(resp.Matches)), []string{"sub1", "sub2"}) {
+		t.Errorf("unexpected response: %+v", resp)
+	}
+
+	// The server steps aside once the binary changes
+	later := time.Now().Add(time.Hour)
+	if err := os.Chtimes(exe, later, later); err != nil {
+		t.Fatal(err)
+	}
+	resp, err = ask(sock, serverRequest{Line: "cmd sub", Point: -1, Dir: dir})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !resp.Stale || len(resp.Matches) != 0 {
+		t.Errorf("expected stale response, got: %+v", resp)
+	}
+
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Errorf("serve: %v", err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("server didn't exit after binary changed")
+	}
+	if _, err := ask(sock, serverRequest{Line: "cmd ", Dir: dir}); err == nil {
+		t.Error("server still accepting requests")
+	}
+}
+
+func TestServer_Idle(t *testing.T) {
+	l, err := net.Listen("unix", filepath.Join(t.TempDir(), "s"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	c := New2(NopParser(Command{}), Server(10*time.Millisecond))
+	if err := c.serve(l, os.Args[0]); err != nil {
+		t.Errorf("serve: %v", err)
+	}
+}
+
+func TestServer_Dir(t *testing.T) {
+	internal.Chdir(t)
+
+	// The client is somewhere other than the server's working directory
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "client.txt"), nil, 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	sockDir, err := os.MkdirTemp("", "cmp")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.RemoveAll(sockDir) })
+	sock := filepath.Join(sockDir, "s")
+	l, err := net.Listen("unix", sock)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	c := New2(NopParser(Command{Args: PredictFiles("*.txt")}), Server(time.Minute))
+	go c.serve(l, os.Args[0])
+	t.Cleanup(func() { l.Close() })
+
+	wd, _ := os.Getwd()
+	resp, err := ask(sock, serverRequest{Line: "cmd cl", Point: -1, Dir: dir})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !equalSlices(resp.Matches, []string{"client.txt"}) {
+		t.Errorf("expected files from the client's directory, got: %+v", resp)
+	}
+	if now, _ := os.Getwd(); now != wd {
+		t.Errorf("server changed directory to %s", now)
+	}
+}
+
+func TestSocketDir(t *testing.T) {
+	tmp := t.TempDir()
+	t.Setenv("TMPDIR", tmp)
+	t.Setenv("XDG_RUNTIME_DIR", "")
+	want := filepath.Join(tmp, fmt.Sprintf("complete-%d", os.Getuid()))
+
+	dir, err := socketDir()
+	if err != nil || dir != want {
+		t.Fatalf("socketDir() = %q, %v; want %q", dir, err, want)
+	}
+
+	// Another user could have made it first, readable by others
+	if err := os.Chmod(dir, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := socketDir(); err == nil {
+		t.Error("expected an error for a directory others can access")
+	}
+
+	// Or pointed it somewhere else
+	os.Remove(dir)
+	if err := os.Symlink(t.TempDir(), dir); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := socketDir(); err == nil {
+		t.Error("expected an error for a symlink")
+	}
+
+	runtime := t.TempDir()
+	t.Setenv("XDG_RUNTIME_DIR", runtime)
+	if dir, err := socketDir(); err != nil || dir != filepath.Join(runtime, "complete") {
+		t.Errorf("socketDir() = %q, %v; want it in XDG_RUNTIME_DIR", dir, err)
+	}
+}
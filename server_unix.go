@@ -0,0 +1,30 @@
+//go:build unix
+
+package complete
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"os/exec"
+	"syscall"
+)
+
+// detach the server from the shell's session, so it outlives the terminal and
+// doesn't receive its signals
+func detach(cmd *exec.Cmd) {
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setsid: true}
+}
+
+// checkOwner returns an error unless the file was created by the current user
+func checkOwner(info fs.FileInfo) error {
+	stat, ok := info.Sys().(*syscall.Stat_t)
+	if !ok {
+		return errors.New("unknown owner")
+	}
+	if uid := os.Getuid(); int(stat.Uid) != uid {
+		return fmt.Errorf("owned by uid %d, not %d", stat.Uid, uid)
+	}
+	return nil
+}